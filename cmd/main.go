@@ -5,7 +5,9 @@ import (
 	"farmako-coupon-service/database"
 	"farmako-coupon-service/docs"
 	"farmako-coupon-service/server"
+	"farmako-coupon-service/usercontext"
 	"farmako-coupon-service/utils"
+	"farmako-coupon-service/worker"
 	"fmt"
 	"log"
 	"math/rand"
@@ -24,7 +26,8 @@ import (
 )
 
 const (
-	shutDownTimeOut = 10 * time.Second
+	shutDownTimeOut          = 10 * time.Second
+	reservationSweepInterval = time.Minute
 )
 
 func init() {
@@ -66,6 +69,13 @@ func main() {
 	}
 	logrus.Info("database connection and migration successful...")
 
+	// the coupon rules read the user context from the profiles kept by the user and order services
+	usercontext.SetDefault(usercontext.NewTableProvider(database.FCS))
+
+	// release the coupon reservations whose TTL has expired
+	stopSweeper := make(chan struct{})
+	go worker.StartReservationSweeper(reservationSweepInterval, stopSweeper)
+
 	go func() {
 		// setup swagger route only on dev or local development
 		if !utils.IsBranchEnvSet() || utils.GetBranch() == utils.Development {
@@ -97,6 +107,8 @@ func main() {
 
 	logrus.Info("shutting down server")
 
+	close(stopSweeper)
+
 	if err := database.ShutdownDatabase(); err != nil {
 		logrus.WithError(err).Error("failed to close database connection")
 	}
@@ -0,0 +1,9 @@
+BEGIN;
+
+CREATE TABLE coupon_applicable_charges (
+    id                   SERIAL PRIMARY KEY,
+    coupon_id            UUID REFERENCES coupons(id) ON DELETE CASCADE,
+    charge_type          TEXT CHECK (charge_type IN ('delivery', 'packaging', 'convenience', 'platform')) NOT NULL
+);
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- coupons created without a validity window were stored with the zero time
+UPDATE coupons SET valid_from = NULL WHERE valid_from = '0001-01-01 00:00:00';
+UPDATE coupons SET valid_to = NULL WHERE valid_to = '0001-01-01 00:00:00';
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS coupon_usages_coupon_id_user_id_idx;
+
+ALTER TABLE coupon_usages ADD CONSTRAINT coupon_usages_coupon_id_key UNIQUE (coupon_id);
+
+COMMIT;
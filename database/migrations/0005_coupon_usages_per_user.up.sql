@@ -0,0 +1,8 @@
+BEGIN;
+
+-- a coupon can be used by many users, the per user limit is enforced while recording the usage
+ALTER TABLE coupon_usages DROP CONSTRAINT IF EXISTS coupon_usages_coupon_id_key;
+
+CREATE INDEX IF NOT EXISTS coupon_usages_coupon_id_user_id_idx ON coupon_usages (coupon_id, user_id);
+
+COMMIT;
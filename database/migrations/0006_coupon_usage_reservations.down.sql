@@ -0,0 +1,13 @@
+BEGIN;
+
+DROP INDEX IF EXISTS coupon_usages_reserved_expires_at_idx;
+DROP INDEX IF EXISTS coupon_usages_order_id_coupon_id_idx;
+
+ALTER TABLE coupon_usages
+    DROP COLUMN IF EXISTS order_id,
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS discount_amount,
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS updated_at;
+
+COMMIT;
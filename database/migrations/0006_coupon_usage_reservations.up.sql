@@ -0,0 +1,17 @@
+BEGIN;
+
+-- usages are reserved for an order first and then committed or released
+ALTER TABLE coupon_usages
+    ADD COLUMN order_id             TEXT,
+    ADD COLUMN status               TEXT CHECK (status IN ('reserved', 'committed', 'released')) NOT NULL DEFAULT 'committed',
+    ADD COLUMN discount_amount      NUMERIC NOT NULL DEFAULT 0,
+    ADD COLUMN expires_at           TIMESTAMP,
+    ADD COLUMN updated_at           TIMESTAMP DEFAULT NOW();
+
+CREATE UNIQUE INDEX IF NOT EXISTS coupon_usages_order_id_coupon_id_idx
+    ON coupon_usages (order_id, coupon_id) WHERE status <> 'released';
+
+CREATE INDEX IF NOT EXISTS coupon_usages_reserved_expires_at_idx
+    ON coupon_usages (expires_at) WHERE status = 'reserved';
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+-- rewriting the reversed usages as released would lose the refunds along with the reversal history
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM coupon_usages WHERE status = 'reversed') THEN
+        RAISE EXCEPTION 'reversed coupon usages exist, they can not be rolled back without losing the refund history';
+    END IF;
+END $$;
+
+DROP TABLE IF EXISTS coupon_usage_reversals;
+
+ALTER TABLE coupon_usages DROP CONSTRAINT IF EXISTS coupon_usages_status_check;
+ALTER TABLE coupon_usages
+    ADD CONSTRAINT coupon_usages_status_check CHECK (status IN ('reserved', 'committed', 'released'));
+
+COMMIT;
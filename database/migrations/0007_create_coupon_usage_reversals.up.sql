@@ -0,0 +1,22 @@
+BEGIN;
+
+ALTER TABLE coupon_usages DROP CONSTRAINT IF EXISTS coupon_usages_status_check;
+ALTER TABLE coupon_usages
+    ADD CONSTRAINT coupon_usages_status_check CHECK (status IN ('reserved', 'committed', 'released', 'reversed'));
+
+CREATE TABLE coupon_usage_reversals (
+    id                   SERIAL PRIMARY KEY,
+    usage_id             INT REFERENCES coupon_usages(id) ON DELETE CASCADE,
+    coupon_id            UUID REFERENCES coupons(id) ON DELETE CASCADE,
+    user_id              TEXT NOT NULL,
+    order_id             TEXT NOT NULL,
+    refund_type          TEXT CHECK (refund_type IN ('full', 'partial')) NOT NULL,
+    refunded_amount      NUMERIC NOT NULL DEFAULT 0,
+    reason               TEXT NOT NULL,
+    reversed_by          TEXT,
+    created_at           TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS coupon_usage_reversals_order_id_idx ON coupon_usage_reversals (order_id);
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS coupon_status_history;
+
+ALTER TABLE coupons DROP COLUMN IF EXISTS status;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+ALTER TABLE coupons
+    ADD COLUMN status TEXT CHECK (status IN ('draft', 'active', 'paused', 'archived')) NOT NULL DEFAULT 'active';
+
+CREATE TABLE coupon_status_history (
+    id                   SERIAL PRIMARY KEY,
+    coupon_id            UUID REFERENCES coupons(id) ON DELETE CASCADE,
+    from_status          TEXT NOT NULL,
+    to_status            TEXT NOT NULL,
+    changed_by           TEXT NOT NULL,
+    reason               TEXT,
+    changed_at           TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS coupon_status_history_coupon_id_idx ON coupon_status_history (coupon_id);
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS coupons_coupon_code_upper_idx;
+
+ALTER TABLE coupons ADD CONSTRAINT coupons_coupon_code_key UNIQUE (coupon_code);
+
+COMMIT;
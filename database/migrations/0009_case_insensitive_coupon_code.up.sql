@@ -0,0 +1,28 @@
+BEGIN;
+
+-- codes like save20 and SAVE20 can not be merged automatically, they are listed so that they can be renamed
+-- before running the migration again (migrate force 8 clears the failed attempt)
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(codes, '; ') INTO duplicates FROM (
+        SELECT string_agg(coupon_code, ', ' ORDER BY coupon_code) AS codes
+        FROM coupons
+        GROUP BY UPPER(TRIM(coupon_code))
+        HAVING COUNT(*) > 1
+    ) AS groups;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'coupon codes differing only by case or spaces must be renamed first: %', duplicates;
+    END IF;
+END $$;
+
+-- coupon codes are stored trimmed and in uppercase, save20 and SAVE20 are the same code
+ALTER TABLE coupons DROP CONSTRAINT IF EXISTS coupons_coupon_code_key;
+
+UPDATE coupons SET coupon_code = UPPER(TRIM(coupon_code));
+
+CREATE UNIQUE INDEX IF NOT EXISTS coupons_coupon_code_upper_idx ON coupons (UPPER(coupon_code));
+
+COMMIT;
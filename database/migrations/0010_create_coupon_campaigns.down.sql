@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS coupons_campaign_id_idx;
+
+ALTER TABLE coupons DROP COLUMN IF EXISTS campaign_id;
+
+DROP TABLE IF EXISTS coupon_campaigns;
+
+COMMIT;
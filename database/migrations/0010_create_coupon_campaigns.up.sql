@@ -0,0 +1,15 @@
+BEGIN;
+
+CREATE TABLE coupon_campaigns (
+    id                   UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name                 TEXT NOT NULL,
+    prefix               TEXT NOT NULL DEFAULT '',
+    code_count           INT NOT NULL,
+    created_at           TIMESTAMP DEFAULT NOW()
+);
+
+ALTER TABLE coupons ADD COLUMN campaign_id UUID REFERENCES coupon_campaigns(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS coupons_campaign_id_idx ON coupons (campaign_id);
+
+COMMIT;
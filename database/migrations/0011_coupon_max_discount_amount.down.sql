@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE coupons DROP COLUMN IF EXISTS max_discount_amount;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- caps the discount of a coupon, "20% off up to 150", no cap when NULL
+ALTER TABLE coupons ADD COLUMN max_discount_amount NUMERIC CHECK (max_discount_amount > 0);
+
+COMMIT;
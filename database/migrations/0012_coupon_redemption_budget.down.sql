@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE coupons
+    DROP COLUMN IF EXISTS max_total_redemptions,
+    DROP COLUMN IF EXISTS discount_budget,
+    DROP COLUMN IF EXISTS redemptions_used,
+    DROP COLUMN IF EXISTS discount_used;
+
+COMMIT;
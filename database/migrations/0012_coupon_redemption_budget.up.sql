@@ -0,0 +1,21 @@
+BEGIN;
+
+-- caps the redemptions and the total discount of a coupon across all the users, no cap when NULL.
+-- redemptions_used and discount_used count the committed usages and the reservations not released yet.
+ALTER TABLE coupons
+    ADD COLUMN max_total_redemptions    INT CHECK (max_total_redemptions > 0),
+    ADD COLUMN discount_budget          NUMERIC CHECK (discount_budget > 0),
+    ADD COLUMN redemptions_used         INT NOT NULL DEFAULT 0,
+    ADD COLUMN discount_used            NUMERIC NOT NULL DEFAULT 0;
+
+UPDATE coupons
+SET redemptions_used = usages.redemptions, discount_used = usages.discount
+FROM (
+    SELECT coupon_id, COUNT(*) AS redemptions, SUM(discount_amount) AS discount
+    FROM coupon_usages
+    WHERE status IN ('reserved', 'committed')
+    GROUP BY coupon_id
+) usages
+WHERE coupons.id = usages.coupon_id;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+ALTER TABLE coupons
+    DROP COLUMN IF EXISTS stackable,
+    DROP COLUMN IF EXISTS exclusivity_group;
+
+COMMIT;
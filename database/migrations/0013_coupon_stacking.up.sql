@@ -0,0 +1,8 @@
+BEGIN;
+
+-- stackable coupons can be combined with other stackable coupons, at most one coupon of an exclusivity group applies
+ALTER TABLE coupons
+    ADD COLUMN stackable                BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN exclusivity_group        TEXT;
+
+COMMIT;
@@ -0,0 +1,21 @@
+BEGIN;
+
+-- deleting the coupons would cascade to their usages, reversals and status history, so they must be archived
+-- and removed by hand before rolling back
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM coupons WHERE discount_type = 'buy_x_get_y') THEN
+        RAISE EXCEPTION 'buy_x_get_y coupons exist, they can not be rolled back without losing their redemption history';
+    END IF;
+END $$;
+
+ALTER TABLE coupons
+    DROP COLUMN IF EXISTS buy_quantity,
+    DROP COLUMN IF EXISTS get_quantity,
+    DROP COLUMN IF EXISTS reward_medicine_id;
+
+ALTER TABLE coupons DROP CONSTRAINT IF EXISTS coupons_discount_type_check;
+ALTER TABLE coupons ADD CONSTRAINT coupons_discount_type_check
+    CHECK (discount_type IN ('percentage', 'fixed'));
+
+COMMIT;
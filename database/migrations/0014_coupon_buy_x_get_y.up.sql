@@ -0,0 +1,14 @@
+BEGIN;
+
+-- buy_x_get_y coupons give get_quantity units free for every buy_quantity qualifying units,
+-- the free units are of the reward medicine or the cheapest qualifying units when it is not set
+ALTER TABLE coupons DROP CONSTRAINT IF EXISTS coupons_discount_type_check;
+ALTER TABLE coupons ADD CONSTRAINT coupons_discount_type_check
+    CHECK (discount_type IN ('percentage', 'fixed', 'buy_x_get_y'));
+
+ALTER TABLE coupons
+    ADD COLUMN buy_quantity             INT CHECK (buy_quantity > 0),
+    ADD COLUMN get_quantity             INT CHECK (get_quantity > 0),
+    ADD COLUMN reward_medicine_id       TEXT;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+-- deleting the coupons would cascade to their usages, reversals and status history, so they must be archived
+-- and removed by hand before rolling back
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM coupons WHERE discount_type = 'tiered') THEN
+        RAISE EXCEPTION 'tiered coupons exist, they can not be rolled back without losing their redemption history';
+    END IF;
+END $$;
+
+DROP TABLE IF EXISTS coupon_discount_tiers;
+
+ALTER TABLE coupons DROP CONSTRAINT IF EXISTS coupons_discount_type_check;
+ALTER TABLE coupons ADD CONSTRAINT coupons_discount_type_check
+    CHECK (discount_type IN ('percentage', 'fixed', 'buy_x_get_y'));
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+ALTER TABLE coupons DROP CONSTRAINT IF EXISTS coupons_discount_type_check;
+ALTER TABLE coupons ADD CONSTRAINT coupons_discount_type_check
+    CHECK (discount_type IN ('percentage', 'fixed', 'buy_x_get_y', 'tiered'));
+
+-- slabs of the tiered coupons, the highest slab reached by the eligible subtotal applies
+CREATE TABLE coupon_discount_tiers (
+    id                   SERIAL PRIMARY KEY,
+    coupon_id            UUID REFERENCES coupons(id) ON DELETE CASCADE,
+    min_subtotal         NUMERIC NOT NULL CHECK (min_subtotal > 0),
+    discount_type        TEXT CHECK (discount_type IN ('percentage', 'fixed')) NOT NULL,
+    discount_value       NUMERIC NOT NULL CHECK (discount_value > 0),
+    UNIQUE (coupon_id, min_subtotal)
+);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- optional rule the cart has to satisfy, for example cart.total >= 999 && "diabetes" in cart.categories
+ALTER TABLE coupons ADD COLUMN eligibility_rule TEXT;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP TABLE IF EXISTS user_segments;
+DROP TABLE IF EXISTS user_profiles;
+
+ALTER TABLE coupons
+    DROP COLUMN IF EXISTS first_order_only,
+    DROP COLUMN IF EXISTS signup_within_days;
+
+COMMIT;
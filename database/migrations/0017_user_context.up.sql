@@ -0,0 +1,22 @@
+BEGIN;
+
+-- first order coupons apply only to users without orders, signup window coupons only to users who signed up recently
+ALTER TABLE coupons
+    ADD COLUMN first_order_only         BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN signup_within_days       INT CHECK (signup_within_days > 0);
+
+-- the user context read by the coupon rules, kept up to date by the user and order services
+CREATE TABLE user_profiles (
+    user_id              TEXT PRIMARY KEY,
+    order_count          INT NOT NULL DEFAULT 0 CHECK (order_count >= 0),
+    signed_up_at         TIMESTAMP,
+    updated_at           TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE user_segments (
+    user_id              TEXT REFERENCES user_profiles(user_id) ON DELETE CASCADE,
+    segment              TEXT NOT NULL,
+    PRIMARY KEY (user_id, segment)
+);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS coupon_audience_users;
+DROP TABLE IF EXISTS coupon_audience_segments;
+
+COMMIT;
@@ -0,0 +1,20 @@
+BEGIN;
+
+-- segments allowed or denied a coupon, a coupon with an allowlist is private to the allowed users and segments
+CREATE TABLE coupon_audience_segments (
+    coupon_id            UUID REFERENCES coupons(id) ON DELETE CASCADE,
+    list_type            TEXT CHECK (list_type IN ('allow', 'deny')) NOT NULL,
+    segment              TEXT NOT NULL,
+    PRIMARY KEY (coupon_id, list_type, segment)
+);
+
+-- users allowed or denied a coupon, the lists can be large and are uploaded in bulk
+CREATE TABLE coupon_audience_users (
+    coupon_id            UUID REFERENCES coupons(id) ON DELETE CASCADE,
+    list_type            TEXT CHECK (list_type IN ('allow', 'deny')) NOT NULL,
+    user_id              TEXT NOT NULL,
+    created_at           TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (coupon_id, list_type, user_id)
+);
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP INDEX IF EXISTS coupon_audience_users_user_id_idx;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- the applicable coupons load every list the user is on at once
+CREATE INDEX IF NOT EXISTS coupon_audience_users_user_id_idx ON coupon_audience_users (user_id);
+
+COMMIT;
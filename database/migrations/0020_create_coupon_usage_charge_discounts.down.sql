@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS coupon_usage_charge_discounts;
+
+COMMIT;
@@ -0,0 +1,12 @@
+BEGIN;
+
+-- the discount a usage gives on each charge type, the rest of its discount_amount is on the items,
+-- so the coupons reserved for one order never discount the cart beyond its amount together
+CREATE TABLE coupon_usage_charge_discounts (
+    usage_id             INT REFERENCES coupon_usages(id) ON DELETE CASCADE,
+    charge_type          TEXT NOT NULL,
+    amount               NUMERIC NOT NULL,
+    PRIMARY KEY (usage_id, charge_type)
+);
+
+COMMIT;
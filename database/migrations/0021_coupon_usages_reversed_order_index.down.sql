@@ -0,0 +1,19 @@
+BEGIN;
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM coupon_usages
+        WHERE status <> 'released'
+        GROUP BY order_id, coupon_id
+        HAVING COUNT(*) > 1
+    ) THEN
+        RAISE EXCEPTION 'coupons were used again by orders after a reversal, they can not be rolled back';
+    END IF;
+END $$;
+
+DROP INDEX IF EXISTS coupon_usages_order_id_coupon_id_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS coupon_usages_order_id_coupon_id_idx
+    ON coupon_usages (order_id, coupon_id) WHERE status <> 'released';
+
+COMMIT;
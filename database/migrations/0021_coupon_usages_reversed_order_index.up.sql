@@ -0,0 +1,8 @@
+BEGIN;
+
+-- a reversed usage no longer holds the coupon for its order, so the order can use the coupon again after a refund
+DROP INDEX IF EXISTS coupon_usages_order_id_coupon_id_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS coupon_usages_order_id_coupon_id_idx
+    ON coupon_usages (order_id, coupon_id) WHERE status NOT IN ('released', 'reversed');
+
+COMMIT;
@@ -0,0 +1,432 @@
+package dbhelper
+
+import (
+	"database/sql"
+	"errors"
+	"farmako-coupon-service/models"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultCouponListLimit = 20
+	maxCouponListLimit     = 100
+)
+
+// ErrCouponInUse is returned when a coupon having usages is deleted
+var ErrCouponInUse = errors.New("coupon has been used and can not be deleted")
+
+// ErrInvalidStatusTransition is returned when the coupon can not move from its current status to the requested one
+var ErrInvalidStatusTransition = errors.New("invalid coupon status transition")
+
+// couponColumns are the columns selected for a coupon
+const couponColumns = `
+	id, coupon_code, expiry_date, usage_type, COALESCE(min_order_value, 0) AS min_order_value,
+	valid_from, valid_to, COALESCE(terms_and_conditions, '') AS terms_and_conditions,
+	discount_type, discount_value, COALESCE(max_discount_amount, 0) AS max_discount_amount,
+	COALESCE(buy_quantity, 0) AS buy_quantity, COALESCE(get_quantity, 0) AS get_quantity,
+	COALESCE(reward_medicine_id, '') AS reward_medicine_id, COALESCE(eligibility_rule, '') AS eligibility_rule,
+	first_order_only, COALESCE(signup_within_days, 0) AS signup_within_days,
+	COALESCE(max_usage_per_user, 1) AS max_usage_per_user, target,
+	COALESCE(max_total_redemptions, 0) AS max_total_redemptions, COALESCE(discount_budget, 0) AS discount_budget,
+	stackable, COALESCE(exclusivity_group, '') AS exclusivity_group,
+	redemptions_used, discount_used, max_total_redemptions - redemptions_used AS remaining_redemptions,
+	discount_budget - discount_used AS remaining_budget,
+	EXISTS (SELECT 1 FROM coupon_audience_users WHERE coupon_id = coupons.id AND list_type = 'allow') AS has_allowed_users,
+	EXISTS (SELECT 1 FROM coupon_audience_users WHERE coupon_id = coupons.id AND list_type = 'deny') AS has_denied_users,
+	status, created_at, updated_at
+`
+
+// IsDuplicateKeyError returns true if the error is a unique constraint violation
+func IsDuplicateKeyError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "duplicate key value")
+}
+
+// IsCheckViolationError returns true if the error is a check constraint violation
+func IsCheckViolationError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "violates check constraint")
+}
+
+// notFoundIfInvalidID maps the error for a malformed coupon id to sql.ErrNoRows
+func notFoundIfInvalidID(err error) error {
+	if err != nil && strings.Contains(err.Error(), "invalid input syntax for type uuid") {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// loadCouponRelations loads the applicable medicines, categories, charges, discount tiers and audience segments
+// of the coupon
+func loadCouponRelations(db sqlx.Queryer, coupon *models.Coupon) error {
+	if err := sqlx.Select(db, &coupon.ApplicableMedicineIDs, `SELECT medicine_id FROM coupon_applicable_medicines WHERE coupon_id = $1`, coupon.ID); err != nil {
+		return err
+	}
+	if err := sqlx.Select(db, &coupon.ApplicableCategories, `SELECT category FROM coupon_applicable_categories WHERE coupon_id = $1`, coupon.ID); err != nil {
+		return err
+	}
+	if err := sqlx.Select(db, &coupon.ApplicableCharges, `SELECT charge_type FROM coupon_applicable_charges WHERE coupon_id = $1`, coupon.ID); err != nil {
+		return err
+	}
+	if err := sqlx.Select(db, &coupon.DiscountTiers, `
+		SELECT min_subtotal, discount_type, discount_value FROM coupon_discount_tiers WHERE coupon_id = $1 ORDER BY min_subtotal
+	`, coupon.ID); err != nil {
+		return err
+	}
+	if err := sqlx.Select(db, &coupon.AllowedSegments, `
+		SELECT segment FROM coupon_audience_segments WHERE coupon_id = $1 AND list_type = 'allow' ORDER BY segment
+	`, coupon.ID); err != nil {
+		return err
+	}
+	return sqlx.Select(db, &coupon.DeniedSegments, `
+		SELECT segment FROM coupon_audience_segments WHERE coupon_id = $1 AND list_type = 'deny' ORDER BY segment
+	`, coupon.ID)
+}
+
+// GetCouponByID fetches the coupon along with its applicable medicines, categories and charges
+func GetCouponByID(db sqlx.Ext, couponID string) (*models.Coupon, error) {
+	return getCouponByID(db, `SELECT `+couponColumns+` FROM coupons WHERE id = $1`, couponID)
+}
+
+// GetCouponByIDForUpdate is GetCouponByID locking the coupon row till the end of the transaction, so the coupon can
+// not change between reading and updating it
+func GetCouponByIDForUpdate(tx *sqlx.Tx, couponID string) (*models.Coupon, error) {
+	return getCouponByID(tx, `SELECT `+couponColumns+` FROM coupons WHERE id = $1 FOR UPDATE`, couponID)
+}
+
+// getCouponByID fetches the coupon with the given query along with its relations
+func getCouponByID(db sqlx.Ext, query, couponID string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	if err := sqlx.Get(db, &coupon, query, couponID); err != nil {
+		return nil, notFoundIfInvalidID(err)
+	}
+
+	if err := loadCouponRelations(db, &coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// ListCoupons returns a page of the coupons matching the filter, newest first, along with the total count
+func ListCoupons(db sqlx.Ext, filter models.CouponFilter) (*models.CouponList, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultCouponListLimit
+	}
+	if filter.Limit > maxCouponListLimit {
+		filter.Limit = maxCouponListLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	where, args := couponFilterConditions(filter)
+
+	list := models.CouponList{Coupons: []models.Coupon{}, Limit: filter.Limit, Offset: filter.Offset}
+	if err := sqlx.Get(db, &list.Total, `SELECT COUNT(*) FROM coupons `+where, args...); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT %s, %s FROM coupons %s ORDER BY created_at DESC, id LIMIT $%d OFFSET $%d`,
+		couponColumns, couponRelationAggregates, where, len(args)+1, len(args)+2)
+	rows, err := db.Queryx(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row couponListRow
+		if err := rows.StructScan(&row); err != nil {
+			return nil, err
+		}
+		if err := row.couponRelations.applyTo(&row.Coupon); err != nil {
+			return nil, err
+		}
+		list.Coupons = append(list.Coupons, row.Coupon)
+	}
+	return &list, rows.Err()
+}
+
+// couponRelationAggregates are the columns selecting the relations of a coupon joined by "|", so a page of coupons
+// is loaded with a single query
+const couponRelationAggregates = `
+	COALESCE((SELECT string_agg(medicine_id, '|' ORDER BY medicine_id) FROM coupon_applicable_medicines WHERE coupon_id = coupons.id), '') AS medicine_ids,
+	COALESCE((SELECT string_agg(category, '|' ORDER BY category) FROM coupon_applicable_categories WHERE coupon_id = coupons.id), '') AS categories,
+	COALESCE((SELECT string_agg(charge_type, '|' ORDER BY charge_type) FROM coupon_applicable_charges WHERE coupon_id = coupons.id), '') AS charges,
+	COALESCE((
+		SELECT string_agg(min_subtotal || ':' || discount_type || ':' || discount_value, '|' ORDER BY min_subtotal)
+		FROM coupon_discount_tiers WHERE coupon_id = coupons.id
+	), '') AS tiers,
+	COALESCE((
+		SELECT string_agg(segment, '|' ORDER BY segment) FROM coupon_audience_segments WHERE coupon_id = coupons.id AND list_type = 'allow'
+	), '') AS allowed_segments,
+	COALESCE((
+		SELECT string_agg(segment, '|' ORDER BY segment) FROM coupon_audience_segments WHERE coupon_id = coupons.id AND list_type = 'deny'
+	), '') AS denied_segments
+`
+
+// couponRelations are the relations of a coupon selected with couponRelationAggregates
+type couponRelations struct {
+	MedicineIDs string `db:"medicine_ids"`
+	Categories  string `db:"categories"`
+	Charges     string `db:"charges"`
+	Tiers       string `db:"tiers"`
+	Allowed     string `db:"allowed_segments"`
+	Denied      string `db:"denied_segments"`
+}
+
+// applyTo splits the aggregated relations into the coupon
+func (relations couponRelations) applyTo(coupon *models.Coupon) error {
+	coupon.ApplicableMedicineIDs = splitAggregate(relations.MedicineIDs)
+	coupon.ApplicableCategories = splitAggregate(relations.Categories)
+	coupon.AllowedSegments = splitAggregate(relations.Allowed)
+	coupon.DeniedSegments = splitAggregate(relations.Denied)
+	coupon.ApplicableCharges = []models.ChargeType{}
+	for _, charge := range splitAggregate(relations.Charges) {
+		coupon.ApplicableCharges = append(coupon.ApplicableCharges, models.ChargeType(charge))
+	}
+
+	var err error
+	coupon.DiscountTiers, err = models.ParseDiscountTiers(relations.Tiers)
+	return err
+}
+
+// couponListRow is a listed coupon with its aggregated relations
+type couponListRow struct {
+	models.Coupon
+	couponRelations
+}
+
+// couponExportRow is an exported coupon with its aggregated relations
+type couponExportRow struct {
+	models.CouponExport
+	couponRelations
+}
+
+// StreamCoupons calls fn for every coupon matching the filter along with its relations and usage counts,
+// oldest first, without loading all of them in memory. The limit and offset of the filter are ignored.
+func StreamCoupons(db sqlx.Queryer, filter models.CouponFilter, fn func(coupon models.CouponExport) error) error {
+	where, args := couponFilterConditions(filter)
+	rows, err := db.Queryx(`
+		SELECT `+couponColumns+`, `+couponRelationAggregates+`,
+			usage.redemption_count, usage.reserved_count, usage.reversed_count, usage.discount_given
+		FROM coupons
+		LEFT JOIN LATERAL (
+			SELECT
+				COUNT(*) FILTER (WHERE status = 'committed') AS redemption_count,
+				COUNT(*) FILTER (WHERE status = 'reserved' AND expires_at > NOW()) AS reserved_count,
+				COUNT(*) FILTER (WHERE status = 'reversed') AS reversed_count,
+				COALESCE(SUM(discount_amount) FILTER (WHERE status = 'committed'), 0) AS discount_given
+			FROM coupon_usages WHERE coupon_id = coupons.id
+		) usage ON TRUE
+		`+where+`
+		ORDER BY created_at, id
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row couponExportRow
+		if err := rows.StructScan(&row); err != nil {
+			return err
+		}
+		if err := row.couponRelations.applyTo(&row.Coupon); err != nil {
+			return err
+		}
+		if err := fn(row.CouponExport); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// splitAggregate splits the values aggregated with "|", an empty aggregate has no values
+func splitAggregate(aggregate string) []string {
+	if aggregate == "" {
+		return []string{}
+	}
+	return strings.Split(aggregate, "|")
+}
+
+// couponFilterConditions builds the WHERE clause and its arguments for the coupon filter
+func couponFilterConditions(filter models.CouponFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Code != "" {
+		addCondition("coupon_code ILIKE $%d", filter.Code+"%")
+	}
+	if filter.Status != "" {
+		addCondition("status = $%d", filter.Status)
+	}
+	if filter.Target != "" {
+		addCondition("target = $%d", filter.Target)
+	}
+	if filter.DiscountType != "" {
+		addCondition("discount_type = $%d", filter.DiscountType)
+	}
+	if filter.UsageType != "" {
+		addCondition("usage_type = $%d", filter.UsageType)
+	}
+	if filter.ExpiresAfter != nil {
+		addCondition("expiry_date >= $%d", *filter.ExpiresAfter)
+	}
+	if filter.ExpiresBefore != nil {
+		addCondition("expiry_date <= $%d", *filter.ExpiresBefore)
+	}
+	if filter.ActiveAt != nil {
+		addCondition("expiry_date > $%[1]d AND (valid_from IS NULL OR valid_from <= $%[1]d) AND (valid_to IS NULL OR valid_to >= $%[1]d)", *filter.ActiveAt)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// UpdateCoupon updates the coupon details, sql.ErrNoRows is returned if the coupon does not exist
+func UpdateCoupon(db sqlx.Ext, coupon *models.Coupon) error {
+	query := `
+		UPDATE coupons SET
+			coupon_code = :coupon_code, expiry_date = :expiry_date, usage_type = :usage_type,
+			min_order_value = :min_order_value, valid_from = :valid_from, valid_to = :valid_to,
+			terms_and_conditions = :terms_and_conditions, discount_type = :discount_type,
+			discount_value = :discount_value, max_discount_amount = NULLIF(:max_discount_amount, 0),
+			buy_quantity = NULLIF(:buy_quantity, 0), get_quantity = NULLIF(:get_quantity, 0),
+			reward_medicine_id = NULLIF(:reward_medicine_id, ''), eligibility_rule = NULLIF(:eligibility_rule, ''),
+			first_order_only = :first_order_only, signup_within_days = NULLIF(:signup_within_days, 0),
+			max_usage_per_user = :max_usage_per_user, target = :target,
+			max_total_redemptions = NULLIF(:max_total_redemptions, 0), discount_budget = NULLIF(:discount_budget, 0),
+			stackable = :stackable, exclusivity_group = NULLIF(:exclusivity_group, ''),
+			updated_at = NOW()
+		WHERE id = :id
+	`
+	res, err := sqlx.NamedExec(db, query, coupon)
+	if err != nil {
+		return notFoundIfInvalidID(err)
+	}
+	return checkRowsAffected(res, sql.ErrNoRows)
+}
+
+// ReplaceCouponRelations replaces the applicable medicines, categories, charges, discount tiers and audience segments
+// of the coupon, the user lists are only changed through the user list endpoints
+func ReplaceCouponRelations(db sqlx.Ext, coupon *models.Coupon) error {
+	tables := []string{
+		"coupon_applicable_medicines", "coupon_applicable_categories", "coupon_applicable_charges", "coupon_discount_tiers",
+		"coupon_audience_segments",
+	}
+	for _, table := range tables {
+		if _, err := db.Exec(`DELETE FROM `+table+` WHERE coupon_id = $1`, coupon.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := InsertCouponApplicableMedicines(db, coupon.ID, coupon.ApplicableMedicineIDs); err != nil {
+		return err
+	}
+	if err := InsertCouponApplicableCategories(db, coupon.ID, coupon.ApplicableCategories); err != nil {
+		return err
+	}
+	if err := InsertCouponApplicableCharges(db, coupon.ID, coupon.ApplicableCharges); err != nil {
+		return err
+	}
+	if err := InsertCouponDiscountTiers(db, coupon.ID, coupon.DiscountTiers); err != nil {
+		return err
+	}
+	if err := InsertCouponAudienceSegments(db, coupon.ID, models.AudienceListAllow, coupon.AllowedSegments); err != nil {
+		return err
+	}
+	return InsertCouponAudienceSegments(db, coupon.ID, models.AudienceListDeny, coupon.DeniedSegments)
+}
+
+// DeleteCoupon deletes a coupon which has never been used, ErrCouponInUse is returned otherwise.
+// It must run inside a transaction, the coupon row is locked before the usages are checked so that a usage
+// reserved or committed meanwhile is seen instead of being removed along with the coupon.
+func DeleteCoupon(db sqlx.Ext, couponID string) error {
+	var lockedID string
+	if err := sqlx.Get(db, &lockedID, `SELECT id FROM coupons WHERE id = $1 FOR UPDATE`, couponID); err != nil {
+		return notFoundIfInvalidID(err)
+	}
+
+	var used bool
+	err := sqlx.Get(db, &used, `
+		SELECT EXISTS (SELECT 1 FROM coupon_usages WHERE coupon_id = $1 AND status <> 'released')
+	`, couponID)
+	if err != nil {
+		return err
+	}
+	if used {
+		return ErrCouponInUse
+	}
+
+	res, err := db.Exec(`DELETE FROM coupons WHERE id = $1`, couponID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res, sql.ErrNoRows)
+}
+
+// ChangeCouponStatus moves the coupon to the given status and records the change in the status history.
+// It must run inside a transaction, the coupon row stays locked till the end of it.
+func ChangeCouponStatus(db sqlx.Ext, couponID string, req models.CouponStatusRequest) (*models.CouponStatusChange, error) {
+	var currentStatus string
+	err := sqlx.Get(db, &currentStatus, `SELECT status FROM coupons WHERE id = $1 FOR UPDATE`, couponID)
+	if err != nil {
+		return nil, notFoundIfInvalidID(err)
+	}
+	if !models.CanTransitionStatus(currentStatus, req.Status) {
+		return nil, fmt.Errorf("%w from %s to %s", ErrInvalidStatusTransition, currentStatus, req.Status)
+	}
+
+	if _, err := db.Exec(`UPDATE coupons SET status = $2, updated_at = NOW() WHERE id = $1`, couponID, req.Status); err != nil {
+		return nil, err
+	}
+
+	var change models.CouponStatusChange
+	err = sqlx.Get(db, &change, `
+		INSERT INTO coupon_status_history (coupon_id, from_status, to_status, changed_by, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, coupon_id, from_status, to_status, changed_by, COALESCE(reason, '') AS reason, changed_at
+	`, couponID, currentStatus, req.Status, req.ChangedBy, req.Reason)
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// insertInitialCouponStatus records the status the coupons matching the condition are created with, the initial
+// status change has an empty from_status
+func insertInitialCouponStatus(db sqlx.Execer, condition string, arg interface{}) error {
+	_, err := db.Exec(`
+		INSERT INTO coupon_status_history (coupon_id, from_status, to_status, changed_by, reason)
+		SELECT id, '', status, 'system', 'coupon created' FROM coupons WHERE `+condition, arg)
+	return err
+}
+
+// GetCouponStatusHistory returns the status changes of the coupon, latest first, sql.ErrNoRows is returned if the
+// coupon does not exist
+func GetCouponStatusHistory(db sqlx.Queryer, couponID string) ([]models.CouponStatusChange, error) {
+	var exists bool
+	if err := sqlx.Get(db, &exists, `SELECT EXISTS (SELECT 1 FROM coupons WHERE id = $1)`, couponID); err != nil {
+		return nil, notFoundIfInvalidID(err)
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	history := make([]models.CouponStatusChange, 0)
+	err := sqlx.Select(db, &history, `
+		SELECT id, coupon_id, from_status, to_status, changed_by, COALESCE(reason, '') AS reason, changed_at
+		FROM coupon_status_history
+		WHERE coupon_id = $1
+		ORDER BY changed_at DESC, id DESC
+	`, couponID)
+	return history, err
+}
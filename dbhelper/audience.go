@@ -0,0 +1,134 @@
+package dbhelper
+
+import (
+	"farmako-coupon-service/database"
+	"farmako-coupon-service/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func InsertCouponAudienceSegments(db sqlx.Ext, couponID, listType string, segments []string) error {
+	for _, segment := range segments {
+		_, err := db.Exec(`
+			INSERT INTO coupon_audience_segments (coupon_id, list_type, segment) VALUES ($1, $2, $3)
+		`, couponID, listType, segment)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddCouponAudienceUsers adds the users to the allowlist or denylist of the coupon in a single statement and
+// returns the number of users added, users already on the list are skipped
+func AddCouponAudienceUsers(db sqlx.Ext, couponID, listType string, userIDs []string) (int64, error) {
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+
+	stmt := database.SetupBindVars(`
+		INSERT INTO coupon_audience_users (coupon_id, list_type, user_id) VALUES %s
+		ON CONFLICT DO NOTHING
+	`, "(?, ?, ?)", len(userIDs))
+
+	args := make([]interface{}, 0, len(userIDs)*3)
+	for _, userID := range userIDs {
+		args = append(args, couponID, listType, userID)
+	}
+
+	res, err := db.Exec(stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ClearCouponAudienceUsers removes every user from the allowlist or denylist of the coupon and returns the
+// number of users removed
+func ClearCouponAudienceUsers(db sqlx.Execer, couponID, listType string) (int64, error) {
+	res, err := db.Exec(`DELETE FROM coupon_audience_users WHERE coupon_id = $1 AND list_type = $2`, couponID, listType)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// CountCouponAudienceUsers returns the number of users on the allowlist or denylist of the coupon
+func CountCouponAudienceUsers(db sqlx.Queryer, couponID, listType string) (int, error) {
+	var count int
+	err := sqlx.Get(db, &count, `
+		SELECT COUNT(*) FROM coupon_audience_users WHERE coupon_id = $1 AND list_type = $2
+	`, couponID, listType)
+	return count, err
+}
+
+// StreamCouponAudienceUsers calls fn for every user on the allowlist or denylist of the coupon ordered by user id,
+// without loading the whole list in memory
+func StreamCouponAudienceUsers(db sqlx.Queryer, couponID, listType string, fn func(userID string) error) error {
+	rows, err := db.Queryx(`
+		SELECT user_id FROM coupon_audience_users WHERE coupon_id = $1 AND list_type = $2 ORDER BY user_id
+	`, couponID, listType)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return err
+		}
+		if err := fn(userID); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// isInCouponAudience returns true if the user of the request can get the coupon. A user or segment on the denylist
+// never gets the coupon, and a private coupon needs the user or one of their segments on the allowlist, so requests
+// without a user only get the public coupons.
+func isInCouponAudience(coupon *models.Coupon, req models.ValidateCouponRequest, lookup userCouponLookup) (bool, error) {
+	var segments []string
+	if req.User != nil {
+		segments = req.User.Segments
+	}
+
+	if containsAny(coupon.DeniedSegments, segments) {
+		return false, nil
+	}
+	if coupon.HasDeniedUsers && req.UserID != "" {
+		denied, err := lookup.IsListedUser(coupon, models.AudienceListDeny)
+		if err != nil || denied {
+			return false, err
+		}
+	}
+
+	if !coupon.IsPrivate() || containsAny(coupon.AllowedSegments, segments) {
+		return true, nil
+	}
+	if coupon.HasAllowedUsers && req.UserID != "" {
+		return lookup.IsListedUser(coupon, models.AudienceListAllow)
+	}
+	return false, nil
+}
+
+func isCouponAudienceUser(db sqlx.Queryer, couponID, listType, userID string) (bool, error) {
+	var found bool
+	err := sqlx.Get(db, &found, `
+		SELECT EXISTS (SELECT 1 FROM coupon_audience_users WHERE coupon_id = $1 AND list_type = $2 AND user_id = $3)
+	`, couponID, listType, userID)
+	return found, err
+}
+
+// containsAny returns true if any of the values is in the list
+func containsAny(list, values []string) bool {
+	for _, value := range values {
+		for _, item := range list {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package dbhelper
+
+import (
+	"errors"
+	"farmako-coupon-service/database"
+	"farmako-coupon-service/models"
+	"farmako-coupon-service/utils"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	campaignBatchSize = 1000
+	// campaignMaxAttempts is the number of batches tried per required batch before giving up on finding unique codes
+	campaignMaxAttempts = 5
+)
+
+// ErrCodeSpaceExhausted is returned when enough unique codes can not be generated for a campaign
+var ErrCodeSpaceExhausted = errors.New("could not generate enough unique codes, use a longer code length or a bigger alphabet")
+
+// CreateCampaign creates the campaign and generates its unique codes in batches, every code is a coupon
+// with the rules of the campaign coupon. It must run inside a transaction.
+func CreateCampaign(db sqlx.Ext, req models.CreateCampaignRequest) (*models.CouponCampaign, error) {
+	var campaign models.CouponCampaign
+	err := sqlx.Get(db, &campaign, `
+		INSERT INTO coupon_campaigns (name, prefix, code_count)
+		VALUES ($1, $2, $3)
+		RETURNING id, name, prefix, code_count, created_at
+	`, req.Name, req.Prefix, req.Count)
+	if err != nil {
+		return nil, err
+	}
+
+	generated := make(map[string]bool, req.Count)
+	remaining := req.Count
+	maxAttempts := campaignMaxAttempts * (req.Count/campaignBatchSize + 1)
+	for attempt := 0; remaining > 0; attempt++ {
+		if attempt >= maxAttempts {
+			return nil, ErrCodeSpaceExhausted
+		}
+
+		batch := make([]string, 0, campaignBatchSize)
+		for len(batch) < remaining && len(batch) < campaignBatchSize {
+			code, err := utils.GenerateCouponCode(req.Prefix, req.Alphabet, req.CodeLength)
+			if err != nil {
+				return nil, err
+			}
+			if generated[code] {
+				continue
+			}
+			generated[code] = true
+			batch = append(batch, code)
+		}
+
+		inserted, err := insertCampaignCoupons(db, campaign.ID, &req.Coupon, batch)
+		if err != nil {
+			return nil, err
+		}
+		remaining -= inserted
+	}
+
+	if err := insertCampaignRelations(db, campaign.ID, &req.Coupon); err != nil {
+		return nil, err
+	}
+	if err := insertInitialCouponStatus(db, `campaign_id = $1`, campaign.ID); err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// insertCampaignCoupons inserts a coupon for every code and returns the number of coupons inserted,
+// codes which already exist are skipped
+func insertCampaignCoupons(db sqlx.Ext, campaignID string, coupon *models.Coupon, codes []string) (int, error) {
+	stmt := database.SetupBindVars(`
+		INSERT INTO coupons (
+			coupon_code, expiry_date, usage_type, min_order_value, valid_from, valid_to,
+			terms_and_conditions, discount_type, discount_value, max_discount_amount, max_usage_per_user, target, status,
+			max_total_redemptions, discount_budget, stackable, exclusivity_group,
+			buy_quantity, get_quantity, reward_medicine_id, eligibility_rule,
+			first_order_only, signup_within_days, campaign_id
+		) VALUES %s
+		ON CONFLICT DO NOTHING
+		RETURNING id
+	`, "(?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?, ?, ?, NULLIF(?, 0), NULLIF(?, 0), ?, NULLIF(?, ''), NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, 0), ?)", len(codes))
+
+	args := make([]interface{}, 0, len(codes)*24)
+	for _, code := range codes {
+		args = append(args, code, coupon.ExpiryDate, coupon.UsageType, coupon.MinOrderValue, coupon.ValidFrom, coupon.ValidTo,
+			coupon.Terms, coupon.DiscountType, coupon.DiscountValue, coupon.MaxDiscountAmount, coupon.MaxUsagePerUser,
+			coupon.Target, coupon.Status, coupon.MaxTotalRedemptions, coupon.DiscountBudget, coupon.Stackable,
+			coupon.ExclusivityGroup, coupon.BuyQuantity, coupon.GetQuantity, coupon.RewardMedicineID,
+			coupon.EligibilityRule, coupon.FirstOrderOnly, coupon.SignupWithinDays, campaignID)
+	}
+
+	var ids []string
+	if err := sqlx.Select(db, &ids, stmt, args...); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// insertCampaignRelations adds the applicable medicines, categories, charges, discount tiers and audience segments
+// to every coupon of the campaign
+func insertCampaignRelations(db sqlx.Ext, campaignID string, coupon *models.Coupon) error {
+	for _, medicineID := range coupon.ApplicableMedicineIDs {
+		_, err := db.Exec(`
+			INSERT INTO coupon_applicable_medicines (coupon_id, medicine_id)
+			SELECT id, $2 FROM coupons WHERE campaign_id = $1
+		`, campaignID, medicineID)
+		if err != nil {
+			return err
+		}
+	}
+	for _, category := range coupon.ApplicableCategories {
+		_, err := db.Exec(`
+			INSERT INTO coupon_applicable_categories (coupon_id, category)
+			SELECT id, $2 FROM coupons WHERE campaign_id = $1
+		`, campaignID, category)
+		if err != nil {
+			return err
+		}
+	}
+	for _, chargeType := range coupon.ApplicableCharges {
+		_, err := db.Exec(`
+			INSERT INTO coupon_applicable_charges (coupon_id, charge_type)
+			SELECT id, $2 FROM coupons WHERE campaign_id = $1
+		`, campaignID, chargeType)
+		if err != nil {
+			return err
+		}
+	}
+	for _, tier := range coupon.DiscountTiers {
+		_, err := db.Exec(`
+			INSERT INTO coupon_discount_tiers (coupon_id, min_subtotal, discount_type, discount_value)
+			SELECT id, $2, $3, $4 FROM coupons WHERE campaign_id = $1
+		`, campaignID, tier.MinSubtotal, tier.DiscountType, tier.DiscountValue)
+		if err != nil {
+			return err
+		}
+	}
+	audience := map[string][]string{models.AudienceListAllow: coupon.AllowedSegments, models.AudienceListDeny: coupon.DeniedSegments}
+	for listType, segments := range audience {
+		for _, segment := range segments {
+			_, err := db.Exec(`
+				INSERT INTO coupon_audience_segments (coupon_id, list_type, segment)
+				SELECT id, $2, $3 FROM coupons WHERE campaign_id = $1
+			`, campaignID, listType, segment)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetCampaign fetches the coupon campaign
+func GetCampaign(db sqlx.Queryer, campaignID string) (*models.CouponCampaign, error) {
+	var campaign models.CouponCampaign
+	err := sqlx.Get(db, &campaign, `
+		SELECT id, name, prefix, code_count, created_at FROM coupon_campaigns WHERE id = $1
+	`, campaignID)
+	if err != nil {
+		return nil, notFoundIfInvalidID(err)
+	}
+	return &campaign, nil
+}
+
+// StreamCampaignCodes calls fn for every code of the campaign without loading all of them in memory
+func StreamCampaignCodes(db sqlx.Queryer, campaignID string, fn func(code models.CampaignCode) error) error {
+	rows, err := db.Queryx(`
+		SELECT coupon_code, status, expiry_date FROM coupons WHERE campaign_id = $1 ORDER BY coupon_code
+	`, campaignID)
+	if err != nil {
+		return notFoundIfInvalidID(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code models.CampaignCode
+		if err := rows.StructScan(&code); err != nil {
+			return err
+		}
+		if err := fn(code); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -1,27 +1,37 @@
 package dbhelper
 
 import (
+	"farmako-coupon-service/discount"
 	"farmako-coupon-service/models"
+	"farmako-coupon-service/rules"
 	"fmt"
-	"strings"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 )
 
-func CreateCouponWithTx(tx *sqlx.Tx, coupon *models.Coupon) (string, error) {
+func CreateCouponWithTx(db sqlx.Ext, coupon *models.Coupon) (string, error) {
 	var couponID string
 
 	query := `
 		INSERT INTO coupons (
 			coupon_code, expiry_date, usage_type, min_order_value, valid_from, valid_to,
-			terms_and_conditions, discount_type, discount_value, max_usage_per_user, target
+			terms_and_conditions, discount_type, discount_value, max_discount_amount, max_usage_per_user, target, status,
+			max_total_redemptions, discount_budget, stackable, exclusivity_group,
+			buy_quantity, get_quantity, reward_medicine_id, eligibility_rule, first_order_only, signup_within_days
 		) VALUES (
 			:coupon_code, :expiry_date, :usage_type, :min_order_value, :valid_from, :valid_to,
-			:terms_and_conditions, :discount_type, :discount_value, :max_usage_per_user, :target
+			:terms_and_conditions, :discount_type, :discount_value, NULLIF(:max_discount_amount, 0), :max_usage_per_user, :target,
+			COALESCE(NULLIF(:status, ''), 'active'), NULLIF(:max_total_redemptions, 0), NULLIF(:discount_budget, 0),
+			:stackable, NULLIF(:exclusivity_group, ''),
+			NULLIF(:buy_quantity, 0), NULLIF(:get_quantity, 0), NULLIF(:reward_medicine_id, ''),
+			NULLIF(:eligibility_rule, ''), :first_order_only, NULLIF(:signup_within_days, 0)
 		) RETURNING id
 	`
-	rows, err := tx.NamedQuery(query, coupon)
+	rows, err := sqlx.NamedQuery(db, query, coupon)
 	if err != nil {
 		return "", err
 	}
@@ -36,9 +46,71 @@ func CreateCouponWithTx(tx *sqlx.Tx, coupon *models.Coupon) (string, error) {
 	return couponID, nil
 }
 
-func InsertCouponApplicableMedicines(tx *sqlx.Tx, couponID string, medicineIDs []string) error {
+// CreateCoupon inserts the coupon along with its applicable medicines, categories, charges, tiers and audience segments
+func CreateCoupon(db sqlx.Ext, coupon *models.Coupon) (string, error) {
+	// Insert core coupon
+	couponID, err := CreateCouponWithTx(db, coupon)
+	if err != nil {
+		return "", errors.Wrapf(err, "CreateCoupon: Failed to create coupon")
+	}
+
+	// Record the initial status
+	if err := insertInitialCouponStatus(db, `id = $1`, couponID); err != nil {
+		return "", errors.Wrapf(err, "CreateCoupon: Failed to record the initial status")
+	}
+
+	// Insert medicines
+	if err := InsertCouponApplicableMedicines(db, couponID, coupon.ApplicableMedicineIDs); err != nil {
+		return "", errors.Wrapf(err, "CreateCoupon: Failed to insert applicable medicines")
+	}
+
+	// Insert categories
+	if err := InsertCouponApplicableCategories(db, couponID, coupon.ApplicableCategories); err != nil {
+		return "", errors.Wrapf(err, "CreateCoupon: Failed to insert applicable categories")
+	}
+
+	// Insert charges
+	if err := InsertCouponApplicableCharges(db, couponID, coupon.ApplicableCharges); err != nil {
+		return "", errors.Wrapf(err, "CreateCoupon: Failed to insert applicable charges")
+	}
+
+	// Insert tiers
+	if err := InsertCouponDiscountTiers(db, couponID, coupon.DiscountTiers); err != nil {
+		return "", errors.Wrapf(err, "CreateCoupon: Failed to insert discount tiers")
+	}
+
+	// Insert audience segments
+	if err := InsertCouponAudienceSegments(db, couponID, models.AudienceListAllow, coupon.AllowedSegments); err != nil {
+		return "", errors.Wrapf(err, "CreateCoupon: Failed to insert allowed segments")
+	}
+	if err := InsertCouponAudienceSegments(db, couponID, models.AudienceListDeny, coupon.DeniedSegments); err != nil {
+		return "", errors.Wrapf(err, "CreateCoupon: Failed to insert denied segments")
+	}
+	return couponID, nil
+}
+
+// ImportCoupon creates the coupon inside a savepoint so that a failed coupon does not abort the
+// whole import transaction
+func ImportCoupon(db sqlx.Ext, coupon *models.Coupon) (string, error) {
+	if _, err := db.Exec(`SAVEPOINT import_coupon`); err != nil {
+		return "", err
+	}
+
+	couponID, err := CreateCoupon(db, coupon)
+	if err != nil {
+		if _, rollbackErr := db.Exec(`ROLLBACK TO SAVEPOINT import_coupon`); rollbackErr != nil {
+			return "", rollbackErr
+		}
+		return "", err
+	}
+
+	_, err = db.Exec(`RELEASE SAVEPOINT import_coupon`)
+	return couponID, err
+}
+
+func InsertCouponApplicableMedicines(db sqlx.Ext, couponID string, medicineIDs []string) error {
 	for _, medID := range medicineIDs {
-		_, err := tx.Exec(`INSERT INTO coupon_applicable_medicines (coupon_id, medicine_id) VALUES ($1, $2)`, couponID, medID)
+		_, err := db.Exec(`INSERT INTO coupon_applicable_medicines (coupon_id, medicine_id) VALUES ($1, $2)`, couponID, medID)
 		if err != nil {
 			return err
 		}
@@ -46,9 +118,9 @@ func InsertCouponApplicableMedicines(tx *sqlx.Tx, couponID string, medicineIDs [
 	return nil
 }
 
-func InsertCouponApplicableCategories(tx *sqlx.Tx, couponID string, categories []string) error {
+func InsertCouponApplicableCategories(db sqlx.Ext, couponID string, categories []string) error {
 	for _, category := range categories {
-		_, err := tx.Exec(`INSERT INTO coupon_applicable_categories (coupon_id, category) VALUES ($1, $2)`, couponID, category)
+		_, err := db.Exec(`INSERT INTO coupon_applicable_categories (coupon_id, category) VALUES ($1, $2)`, couponID, category)
 		if err != nil {
 			return err
 		}
@@ -56,33 +128,177 @@ func InsertCouponApplicableCategories(tx *sqlx.Tx, couponID string, categories [
 	return nil
 }
 
-func FetchApplicableCoupons(db *sqlx.DB, cartItems []models.CartItem, orderTotal float64, ts time.Time) ([]models.ApplicableCoupon, error) {
-	query := `
-		SELECT c.coupon_code, c.discount_value
-		FROM coupons c
-		WHERE c.expiry_date > $1 AND $2 >= c.min_order_value
-	`
-	rows, err := db.Queryx(query, ts, orderTotal)
+func InsertCouponApplicableCharges(db sqlx.Ext, couponID string, chargeTypes []models.ChargeType) error {
+	for _, chargeType := range chargeTypes {
+		_, err := db.Exec(`INSERT INTO coupon_applicable_charges (coupon_id, charge_type) VALUES ($1, $2)`, couponID, chargeType)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func InsertCouponDiscountTiers(db sqlx.Ext, couponID string, tiers []models.DiscountTier) error {
+	for _, tier := range tiers {
+		_, err := db.Exec(`
+			INSERT INTO coupon_discount_tiers (coupon_id, min_subtotal, discount_type, discount_value) VALUES ($1, $2, $3, $4)
+		`, couponID, tier.MinSubtotal, tier.DiscountType, tier.DiscountValue)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchCandidateCoupons fetches the active coupons which have not expired yet along with their relations,
+// these are the coupons which can be applicable to a cart. Campaign codes are never offered as applicable.
+func FetchCandidateCoupons(db sqlx.Ext) ([]models.Coupon, error) {
+	coupons := []models.Coupon{}
+	err := sqlx.Select(db, &coupons, `
+		SELECT `+couponColumns+` FROM coupons
+		WHERE status = 'active' AND campaign_id IS NULL AND expiry_date > NOW()
+		ORDER BY coupon_code
+	`)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var coupons []models.ApplicableCoupon
-	for rows.Next() {
-		var c models.ApplicableCoupon
-		if err := rows.StructScan(&c); err != nil {
+	for i := range coupons {
+		if err := loadCouponRelations(db, &coupons[i]); err != nil {
 			return nil, err
 		}
-		coupons = append(coupons, c)
 	}
-
 	return coupons, nil
 }
 
-func ValidateCoupon(db *sqlx.DB, req models.ValidateCouponRequest) (*models.ValidationResult, error) {
-	// Validate coupon details (expiry, discount type, value)
-	validationResult, err := ValidateCouponDetails(db, req.CouponCode, req.Timestamp)
+// FetchApplicableCoupons evaluates every candidate coupon against the cart with the same rules as ValidateCoupon
+// and returns the coupons the user can apply along with their savings, the best coupon is flagged. Coupons failing
+// only on the minimum order value are returned as almost applicable. Private coupons are only returned to the users
+// on their allowlist. The candidates can be cached, their redemption and budget counters are read again along with
+// the usages and the lists of the user in a fixed number of queries. The candidates are not modified.
+func FetchApplicableCoupons(db sqlx.Ext, candidates []models.Coupon, req models.ValidateCouponRequest) (*models.ApplicableCoupons, error) {
+	applicable := models.ApplicableCoupons{
+		Coupons:          []models.ApplicableCoupon{},
+		AlmostApplicable: []models.AlmostApplicableCoupon{},
+	}
+
+	counters, err := fetchCouponCounters(db)
+	if err != nil {
+		return nil, err
+	}
+	lookup, err := preloadUserLookup(db, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range candidates {
+		coupon := candidates[i]
+		counter, found := counters[coupon.ID]
+		if !found {
+			// the coupon is not active anymore
+			continue
+		}
+		coupon.RedemptionsUsed, coupon.DiscountUsed = counter.RedemptionsUsed, counter.DiscountUsed
+		if result := CheckCouponAvailability(&coupon, req.Timestamp); !result.IsValid {
+			continue
+		}
+
+		result, err := evaluateCoupon(&coupon, req, lookup)
+		if err != nil {
+			return nil, err
+		}
+		if result.IsValid {
+			applicable.Coupons = append(applicable.Coupons, models.ApplicableCoupon{
+				CouponCode:        coupon.CouponCode,
+				DiscountValue:     coupon.DiscountValue,
+				MaxDiscountAmount: coupon.MaxDiscountAmount,
+				NextTier:          discount.NextTier(&coupon, discount.EligibleSubtotal(&coupon, req)),
+				Discount:          result.Discount,
+				Savings:           discount.Round(result.Discount.Total()),
+			})
+			continue
+		}
+
+		almost, err := checkAlmostApplicable(&coupon, req, lookup)
+		if err != nil {
+			return nil, err
+		}
+		if almost != nil {
+			applicable.AlmostApplicable = append(applicable.AlmostApplicable, *almost)
+		}
+	}
+
+	// the candidates are sorted by code so the ties keep a stable order
+	sort.SliceStable(applicable.Coupons, func(i, j int) bool {
+		return applicable.Coupons[i].Savings > applicable.Coupons[j].Savings
+	})
+	if len(applicable.Coupons) > 0 && applicable.Coupons[0].Savings > 0 {
+		applicable.Coupons[0].IsBest = true
+	}
+	sort.SliceStable(applicable.AlmostApplicable, func(i, j int) bool {
+		return applicable.AlmostApplicable[i].Shortfall < applicable.AlmostApplicable[j].Shortfall
+	})
+	return &applicable, nil
+}
+
+// couponCounters are the redemption and budget counters of a coupon, they change with every redemption
+type couponCounters struct {
+	ID              string  `db:"id"`
+	RedemptionsUsed int     `db:"redemptions_used"`
+	DiscountUsed    float64 `db:"discount_used"`
+}
+
+// fetchCouponCounters returns the counters of the active coupons which can be applicable by coupon id
+func fetchCouponCounters(db sqlx.Queryer) (map[string]couponCounters, error) {
+	var rows []couponCounters
+	err := sqlx.Select(db, &rows, `
+		SELECT id, redemptions_used, discount_used FROM coupons WHERE status = 'active' AND campaign_id IS NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make(map[string]couponCounters, len(rows))
+	for _, row := range rows {
+		counters[row.ID] = row
+	}
+	return counters, nil
+}
+
+// checkAlmostApplicable returns the coupon as almost applicable if the order is below the minimum order value or
+// the lowest tier of a tiered coupon, and the coupon passes all the other rules once the order reaches it
+func checkAlmostApplicable(coupon *models.Coupon, req models.ValidateCouponRequest, lookup userCouponLookup) (*models.AlmostApplicableCoupon, error) {
+	unlocked := req
+	if unlocked.OrderTotal < coupon.MinOrderValue {
+		unlocked.OrderTotal = coupon.MinOrderValue
+	}
+	if coupon.DiscountType == models.DiscountTypeTiered && !discount.IsRestricted(coupon) {
+		if lowest := discount.LowestTier(coupon); lowest != nil && unlocked.OrderTotal < lowest.MinSubtotal {
+			unlocked.OrderTotal = lowest.MinSubtotal
+		}
+	}
+	if unlocked.OrderTotal == req.OrderTotal {
+		return nil, nil
+	}
+
+	result, err := evaluateCoupon(coupon, unlocked, lookup)
+	if err != nil || !result.IsValid {
+		return nil, err
+	}
+
+	shortfall := discount.Round(unlocked.OrderTotal - req.OrderTotal)
+	return &models.AlmostApplicableCoupon{
+		CouponCode:        coupon.CouponCode,
+		DiscountValue:     coupon.DiscountValue,
+		MaxDiscountAmount: coupon.MaxDiscountAmount,
+		Reason:            fmt.Sprintf("add ₹%s more to unlock", strconv.FormatFloat(shortfall, 'f', -1, 64)),
+		Shortfall:         shortfall,
+	}, nil
+}
+
+func ValidateCoupon(db sqlx.Ext, req models.ValidateCouponRequest) (*models.ValidationResult, error) {
+	// Validate coupon details (expiry)
+	coupon, validationResult, err := ValidateCouponDetails(db, req.CouponCode, req.Timestamp)
 	if err != nil {
 		return nil, err
 	}
@@ -91,93 +307,219 @@ func ValidateCoupon(db *sqlx.DB, req models.ValidateCouponRequest) (*models.Vali
 	if !validationResult.IsValid {
 		return validationResult, nil
 	}
+	return EvaluateCoupon(db, coupon, req)
+}
 
-	// Calculate the items discount based on discount type
-	var itemsDiscount float64
-	if req.OrderTotal > 0 {
-		// Only calculate if the order total is more than zero
-		if req.OrderTotal > 0 && validationResult.Discount.ItemsDiscount > 0 {
-			if validationResult.Discount.ItemsDiscount > req.OrderTotal {
-				itemsDiscount = req.OrderTotal
-			} else {
-				itemsDiscount = validationResult.Discount.ItemsDiscount
-			}
+// EvaluateCoupon checks the cart and the usage of the user against the rules of an available coupon
+// and calculates the discount for the cart
+func EvaluateCoupon(db sqlx.Ext, coupon *models.Coupon, req models.ValidateCouponRequest) (*models.ValidationResult, error) {
+	return evaluateCoupon(coupon, req, queryLookup{db: db, userID: req.UserID})
+}
+
+// evaluateCoupon is EvaluateCoupon reading the usages and the lists of the user through the lookup
+func evaluateCoupon(coupon *models.Coupon, req models.ValidateCouponRequest, lookup userCouponLookup) (*models.ValidationResult, error) {
+	if req.OrderTotal < coupon.MinOrderValue {
+		return &models.ValidationResult{
+			IsValid: false,
+			Message: fmt.Sprintf("minimum order value of %.2f is required for this coupon", coupon.MinOrderValue),
+		}, nil
+	}
+
+	// Coupons restricted to medicines or categories need at least one matching item in the cart
+	if coupon.Target == models.TargetInventory && discount.IsRestricted(coupon) && len(discount.EligibleItems(coupon, req.CartItems)) == 0 {
+		return &models.ValidationResult{
+			IsValid: false,
+			Message: "coupon is not applicable on any item in the cart",
+		}, nil
+	}
+
+	// Charges coupons need at least one matching charge in the order
+	if coupon.Target == models.TargetCharges && len(discount.EligibleCharges(coupon, req.Charges)) == 0 {
+		return &models.ValidationResult{
+			IsValid: false,
+			Message: "coupon is not applicable on any charge in the order",
+		}, nil
+	}
+
+	if result := CheckUserEligibility(coupon, req); !result.IsValid {
+		return result, nil
+	}
+
+	// Private coupons apply only to the allowed users and segments, denied users and segments never get the coupon
+	if coupon.IsPrivate() || coupon.HasDeniedUsers || len(coupon.DeniedSegments) > 0 {
+		inAudience, err := isInCouponAudience(coupon, req, lookup)
+		if err != nil {
+			return nil, err
+		}
+		if !inAudience {
+			return &models.ValidationResult{
+				IsValid: false,
+				Message: "coupon is not available for this user",
+			}, nil
 		}
 	}
 
-	// Return the final validation result with calculated items discount
-	return &models.ValidationResult{
-		IsValid: true,
-		Message: "coupon applied successfully",
-		Discount: models.DiscountBreakdown{
-			ItemsDiscount:   itemsDiscount,
-			ChargesDiscount: 0,
-		},
-	}, nil
-}
+	// The cart has to satisfy the eligibility rule of the coupon
+	if coupon.EligibilityRule != "" {
+		eligible, err := evaluateEligibilityRule(coupon, req)
+		if err != nil {
+			return nil, err
+		}
+		if !eligible {
+			return &models.ValidationResult{
+				IsValid: false,
+				Message: "cart is not eligible for this coupon",
+			}, nil
+		}
+	}
 
-// ValidateCouponDetails will check the validity of the coupon based on the coupon code, expiry date, and discount type.
-func ValidateCouponDetails(db *sqlx.DB, couponCode string, timestamp time.Time) (*models.ValidationResult, error) {
-	query := `
-		SELECT discount_value, discount_type, expiry_date
-		FROM coupons
-		WHERE coupon_code = $1
-	`
-	var discountValue float64
-	var discountType string
-	var expiry time.Time
+	// Coupons with a total redemption cap stop once all the redemptions are taken
+	if coupon.MaxTotalRedemptions > 0 && coupon.RedemptionsUsed >= coupon.MaxTotalRedemptions {
+		return &models.ValidationResult{
+			IsValid: false,
+			Message: "coupon has reached its maximum number of redemptions",
+		}, nil
+	}
 
-	err := db.QueryRow(query, couponCode).Scan(&discountValue, &discountType, &expiry)
-	if err != nil {
-		return nil, fmt.Errorf("coupon not found or expired")
+	// Users can use the coupon only as many times as allowed by the usage type
+	if req.UserID != "" {
+		count, err := lookup.ActiveUsages(coupon)
+		if err != nil {
+			return nil, err
+		}
+		if limit := coupon.UsageLimit(); limit > 0 && count >= limit {
+			return &models.ValidationResult{
+				IsValid: false,
+				Message: "max usage limit reached for this user",
+			}, nil
+		}
 	}
 
-	if timestamp.After(expiry) {
+	// The discount has to fit in what is left of the discount budget
+	breakdown := discount.Calculate(coupon, req)
+	if coupon.DiscountType == models.DiscountTypeBuyXGetY && breakdown.ItemsDiscount <= 0 {
 		return &models.ValidationResult{
 			IsValid: false,
-			Message: "coupon expired or not applicable",
+			Message: discount.BuyXGetYRequirement(coupon),
+		}, nil
+	}
+	if coupon.DiscountType == models.DiscountTypeTiered && discount.ApplicableTier(coupon, discount.EligibleSubtotal(coupon, req)) == nil {
+		// a tiered coupon without any tier left can not give a discount on any order
+		message := "coupon is not applicable on this order"
+		if lowest := discount.LowestTier(coupon); lowest != nil {
+			message = fmt.Sprintf("eligible subtotal of %.2f is required for this coupon", lowest.MinSubtotal)
+		}
+		return &models.ValidationResult{
+			IsValid: false,
+			Message: message,
+		}, nil
+	}
+	if coupon.DiscountBudget > 0 && coupon.DiscountUsed+breakdown.Total() > coupon.DiscountBudget {
+		return &models.ValidationResult{
+			IsValid: false,
+			Message: "coupon discount budget is exhausted",
 		}, nil
 	}
 
-	// Return only necessary fields to validate the coupon
+	// Return the final validation result with the discount calculated as per the discount type
 	return &models.ValidationResult{
-		IsValid: true,
-		Message: "coupon applied successfully",
-		Discount: models.DiscountBreakdown{
-			ItemsDiscount:   discountValue, // Set this field with discount value
-			ChargesDiscount: 0,             // Set ChargesDiscount to 0 for now as no charges discount is given
-		},
+		IsValid:  true,
+		Message:  "coupon applied successfully",
+		Discount: breakdown,
 	}, nil
 }
 
-func RecordCouponUsage(db *sqlx.DB, couponCode string, userID string) error {
-	// Check if coupon has already been used by this user
-	var count int
-	err := db.Get(&count, `
-		SELECT COUNT(*) FROM coupon_usages
-		WHERE coupon_id = (SELECT id FROM coupons WHERE coupon_code = $1) AND user_id = $2
-	`, couponCode, userID)
+// evaluateEligibilityRule returns true if the request satisfies the eligibility rule of the coupon.
+// The rule is checked when the coupon is saved, so a rule failing to compile here is an error. A rule reading
+// the user context is not satisfied when the context of the user is not known.
+func evaluateEligibilityRule(coupon *models.Coupon, req models.ValidateCouponRequest) (bool, error) {
+	rule, err := rules.CompileEligibility(coupon.EligibilityRule)
 	if err != nil {
-		return err
+		return false, errors.Wrapf(err, "invalid eligibility rule of coupon %s", coupon.CouponCode)
 	}
+	eligible, err := rule.Evaluate(rules.EligibilityContext(req))
+	if errors.Is(err, rules.ErrMissingVariable) {
+		return false, nil
+	}
+	return eligible, err
+}
 
-	// Validate against max usage per user
-	if count > 0 {
-		return fmt.Errorf("max usage limit reached for this user")
+// GetCouponByCode fetches the coupon details for the given coupon code
+func GetCouponByCode(db sqlx.Ext, couponCode string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	if err := sqlx.Get(db, &coupon, `SELECT `+couponColumns+` FROM coupons WHERE UPPER(coupon_code) = UPPER($1)`, couponCode); err != nil {
+		return nil, err
 	}
 
-	// Insert coupon usage
-	_, err = db.Exec(`
-		INSERT INTO coupon_usages (coupon_id, user_id)
-		VALUES ((SELECT id FROM coupons WHERE coupon_code = $1), $2)
-	`, couponCode, userID)
+	if err := loadCouponRelations(db, &coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// ValidateCouponDetails will check the validity of the coupon based on the coupon code, status, validity window and expiry date.
+// It returns the coupon along with the validation result so that the discount can be calculated further.
+func ValidateCouponDetails(db sqlx.Ext, couponCode string, timestamp time.Time) (*models.Coupon, *models.ValidationResult, error) {
+	coupon, err := GetCouponByCode(db, couponCode)
 	if err != nil {
-		// Handle unique constraint violation (if concurrent insert)
-		if strings.Contains(err.Error(), "duplicate key value") {
-			return fmt.Errorf("coupon already used by this user")
+		return nil, nil, fmt.Errorf("coupon not found or expired")
+	}
+
+	return coupon, CheckCouponAvailability(coupon, timestamp), nil
+}
+
+// CheckUserEligibility checks the first order and signup window restrictions of the coupon against the context of
+// the user. The signup window counts whole days like the user.days_since_signup rule variable, so a user is within a
+// window of 30 days till day 29 since the signup.
+func CheckUserEligibility(coupon *models.Coupon, req models.ValidateCouponRequest) *models.ValidationResult {
+	// First order coupons need a known user without any order yet
+	if coupon.FirstOrderOnly && (req.User == nil || req.User.OrderCount > 0) {
+		return &models.ValidationResult{
+			IsValid: false,
+			Message: "coupon is only valid on the first order",
 		}
-		return err
 	}
 
-	return nil
+	// Signup window coupons need a user with a known signup date who signed up within the window
+	if coupon.SignupWithinDays > 0 {
+		var days int
+		known := false
+		if req.User != nil {
+			days, known = req.User.DaysSinceSignup(req.Timestamp)
+		}
+		if !known || days >= coupon.SignupWithinDays {
+			return &models.ValidationResult{
+				IsValid: false,
+				Message: fmt.Sprintf("coupon is only valid for users who signed up in the last %d days", coupon.SignupWithinDays),
+			}
+		}
+	}
+
+	return &models.ValidationResult{IsValid: true}
+}
+
+// CheckCouponAvailability checks the status, validity window and expiry date of the coupon at the given time
+func CheckCouponAvailability(coupon *models.Coupon, timestamp time.Time) *models.ValidationResult {
+	if coupon.Status != models.CouponStatusActive {
+		return &models.ValidationResult{
+			IsValid: false,
+			Message: "coupon is not active",
+		}
+	}
+
+	if coupon.ValidFrom != nil && timestamp.Before(*coupon.ValidFrom) {
+		return &models.ValidationResult{
+			IsValid: false,
+			Message: "coupon is not active yet",
+		}
+	}
+
+	if timestamp.After(coupon.ExpiryDate) || (coupon.ValidTo != nil && timestamp.After(*coupon.ValidTo)) {
+		return &models.ValidationResult{
+			IsValid: false,
+			Message: "coupon has expired",
+		}
+	}
+
+	return &models.ValidationResult{IsValid: true}
 }
@@ -0,0 +1,57 @@
+package dbhelper_test
+
+import (
+	"context"
+	"farmako-coupon-service/dbhelper"
+	"farmako-coupon-service/models"
+	"farmako-coupon-service/usercontext"
+	"testing"
+	"time"
+)
+
+func TestCheckUserEligibility(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days float64) *time.Time {
+		signup := now.Add(-time.Duration(days * float64(24*time.Hour)))
+		return &signup
+	}
+	provider := usercontext.NewFakeProvider(
+		models.UserContext{UserID: "new", OrderCount: 0, SignupDate: daysAgo(2)},
+		models.UserContext{UserID: "returning", OrderCount: 3, SignupDate: daysAgo(2)},
+		models.UserContext{UserID: "almost-old", OrderCount: 0, SignupDate: daysAgo(29.9)},
+		models.UserContext{UserID: "old", OrderCount: 0, SignupDate: daysAgo(30)},
+		models.UserContext{UserID: "no-signup", OrderCount: 0},
+	)
+
+	firstOrder := models.Coupon{FirstOrderOnly: true}
+	signupWindow := models.Coupon{SignupWithinDays: 30}
+	tests := []struct {
+		coupon models.Coupon
+		userID string
+		want   bool
+	}{
+		{firstOrder, "new", true},
+		{firstOrder, "returning", false},
+		{firstOrder, "unknown", false},
+		{firstOrder, "", false},
+		{signupWindow, "new", true},
+		{signupWindow, "returning", true},
+		{signupWindow, "almost-old", true},
+		{signupWindow, "old", false},
+		{signupWindow, "no-signup", false},
+		{signupWindow, "unknown", false},
+		{models.Coupon{}, "unknown", true},
+	}
+	for _, test := range tests {
+		user, err := provider.UserContext(context.Background(), test.userID)
+		if err != nil {
+			t.Fatalf("UserContext(%q) failed: %v", test.userID, err)
+		}
+		req := models.ValidateCouponRequest{UserID: test.userID, Timestamp: now, User: user}
+		result := dbhelper.CheckUserEligibility(&test.coupon, req)
+		if result.IsValid != test.want {
+			t.Errorf("CheckUserEligibility(first_order_only=%v, signup_within_days=%d) for user %q = %v (%s), want %v",
+				test.coupon.FirstOrderOnly, test.coupon.SignupWithinDays, test.userID, result.IsValid, result.Message, test.want)
+		}
+	}
+}
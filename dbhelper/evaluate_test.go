@@ -0,0 +1,29 @@
+package dbhelper
+
+import (
+	"farmako-coupon-service/models"
+	"testing"
+	"time"
+)
+
+func TestEvaluateTieredCouponWithoutTiers(t *testing.T) {
+	coupon := models.Coupon{
+		DiscountType: models.DiscountTypeTiered,
+		Target:       models.TargetInventory,
+		UsageType:    models.UsageTypeMultiUse,
+		Status:       models.CouponStatusActive,
+	}
+	req := models.ValidateCouponRequest{
+		OrderTotal: 1000,
+		CartItems:  []models.CartItem{{ID: "med_123", Price: 500, Quantity: 2}},
+		Timestamp:  time.Now(),
+	}
+
+	result, err := evaluateCoupon(&coupon, req, preloadedLookup{})
+	if err != nil {
+		t.Fatalf("evaluateCoupon failed: %v", err)
+	}
+	if result.IsValid {
+		t.Errorf("evaluateCoupon of a tiered coupon without tiers = valid, want invalid")
+	}
+}
@@ -0,0 +1,75 @@
+package dbhelper
+
+import (
+	"farmako-coupon-service/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// userCouponLookup answers the questions about the user of a request asked while evaluating a coupon
+type userCouponLookup interface {
+	// ActiveUsages returns the number of times the user has used or reserved the coupon
+	ActiveUsages(coupon *models.Coupon) (int, error)
+	// IsListedUser returns true if the user is on the allowlist or denylist of the coupon
+	IsListedUser(coupon *models.Coupon, listType string) (bool, error)
+}
+
+// queryLookup looks up the user for a single coupon at a time
+type queryLookup struct {
+	db     sqlx.Queryer
+	userID string
+}
+
+func (l queryLookup) ActiveUsages(coupon *models.Coupon) (int, error) {
+	return CountActiveUsages(l.db, coupon, l.userID)
+}
+
+func (l queryLookup) IsListedUser(coupon *models.Coupon, listType string) (bool, error) {
+	return isCouponAudienceUser(l.db, coupon.ID, listType, l.userID)
+}
+
+// preloadedLookup holds the usages and the list memberships of the user across all the coupons, so that many
+// coupons can be evaluated without a query per coupon
+type preloadedLookup struct {
+	usages map[string]int
+	// lists maps the list type to the ids of the coupons listing the user
+	lists map[string]map[string]bool
+}
+
+func (l preloadedLookup) ActiveUsages(coupon *models.Coupon) (int, error) {
+	return l.usages[coupon.ID], nil
+}
+
+func (l preloadedLookup) IsListedUser(coupon *models.Coupon, listType string) (bool, error) {
+	return l.lists[listType][coupon.ID], nil
+}
+
+// preloadUserLookup loads the active usages and the list memberships of the user with one query each
+func preloadUserLookup(db sqlx.Queryer, userID string) (preloadedLookup, error) {
+	lookup := preloadedLookup{
+		usages: make(map[string]int),
+		lists:  map[string]map[string]bool{models.AudienceListAllow: {}, models.AudienceListDeny: {}},
+	}
+	if userID == "" {
+		return lookup, nil
+	}
+
+	usages, err := CountActiveUsagesByCoupon(db, userID)
+	if err != nil {
+		return lookup, err
+	}
+	lookup.usages = usages
+
+	var listings []struct {
+		CouponID string `db:"coupon_id"`
+		ListType string `db:"list_type"`
+	}
+	err = sqlx.Select(db, &listings, `SELECT coupon_id, list_type FROM coupon_audience_users WHERE user_id = $1`, userID)
+	if err != nil {
+		return lookup, err
+	}
+	for _, listing := range listings {
+		lookup.lists[listing.ListType][listing.CouponID] = true
+	}
+	return lookup, nil
+}
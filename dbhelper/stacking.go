@@ -0,0 +1,130 @@
+package dbhelper
+
+import (
+	"farmako-coupon-service/discount"
+	"farmako-coupon-service/models"
+	"fmt"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// stackCandidate is a valid coupon of a combined validation waiting to be resolved against the other coupons
+type stackCandidate struct {
+	coupon *models.Coupon
+	result *models.CombinedCouponResult
+}
+
+// ValidateCoupons validates every coupon code against the cart and combines the valid ones. The conflicts are
+// resolved deterministically: the coupons are tried by highest discount first, then by code, and a coupon is
+// applied only if it can stack with the coupons applied before it. A coupon which is not stackable applies alone,
+// at most one coupon of an exclusivity group applies and the combined discount never exceeds the cart.
+func ValidateCoupons(db sqlx.Ext, req models.CombinedValidationRequest) (*models.CombinedValidationResult, error) {
+	combined := models.CombinedValidationResult{Coupons: make([]models.CombinedCouponResult, 0, len(req.CouponCodes))}
+	var candidates []stackCandidate
+
+	for _, code := range req.CouponCodes {
+		combined.Coupons = append(combined.Coupons, models.CombinedCouponResult{CouponCode: code})
+	}
+	for i := range combined.Coupons {
+		result := &combined.Coupons[i]
+
+		couponReq := req.ValidateCouponRequest
+		couponReq.CouponCode = result.CouponCode
+		coupon, validation, err := ValidateCouponDetails(db, couponReq.CouponCode, couponReq.Timestamp)
+		if err != nil {
+			result.Message = err.Error()
+			continue
+		}
+		if validation.IsValid {
+			if validation, err = EvaluateCoupon(db, coupon, couponReq); err != nil {
+				return nil, err
+			}
+		}
+		result.Message = validation.Message
+		if validation.IsValid {
+			result.Discount = validation.Discount
+			candidates = append(candidates, stackCandidate{coupon: coupon, result: result})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		left, right := candidates[i].result, candidates[j].result
+		if left.Discount.Total() != right.Discount.Total() {
+			return left.Discount.Total() > right.Discount.Total()
+		}
+		return left.CouponCode < right.CouponCode
+	})
+
+	var applied []*models.Coupon
+	for _, candidate := range candidates {
+		if message := stackConflict(candidate.coupon, applied); message != "" {
+			candidate.result.Discount = models.DiscountBreakdown{}
+			candidate.result.Message = message
+			continue
+		}
+
+		remaining := discount.Remaining(candidate.result.Discount, combined.Discount, req.ValidateCouponRequest)
+		if remaining.Total() <= 0 {
+			candidate.result.Discount = models.DiscountBreakdown{}
+			candidate.result.Message = "the cart is fully discounted by the other coupons"
+			continue
+		}
+
+		candidate.result.Applied = true
+		candidate.result.Discount = remaining
+		combined.Discount = combined.Discount.Add(remaining)
+		applied = append(applied, candidate.coupon)
+	}
+
+	combined.IsValid = len(applied) > 0
+	combined.Discount.ItemsDiscount = discount.Round(combined.Discount.ItemsDiscount)
+	combined.Discount.ChargesDiscount = discount.Round(combined.Discount.ChargesDiscount)
+	return &combined, nil
+}
+
+// reservedStackConflict returns why the coupon can not be reserved along with the coupons already reserved or
+// used for the order, empty if it can
+func reservedStackConflict(db sqlx.Queryer, couponID, orderID string) (string, error) {
+	var reserved []models.Coupon
+	err := sqlx.Select(db, &reserved, `
+		SELECT id, coupon_code, stackable, COALESCE(exclusivity_group, '') AS exclusivity_group FROM coupons
+		WHERE id IN (
+			SELECT coupon_id FROM coupon_usages WHERE order_id = $1 AND coupon_id <> $2 AND `+activeUsageCondition+`
+		)
+		ORDER BY coupon_code
+	`, orderID, couponID)
+	if err != nil || len(reserved) == 0 {
+		return "", err
+	}
+
+	var coupon models.Coupon
+	err = sqlx.Get(db, &coupon, `
+		SELECT id, coupon_code, stackable, COALESCE(exclusivity_group, '') AS exclusivity_group FROM coupons WHERE id = $1
+	`, couponID)
+	if err != nil {
+		return "", err
+	}
+
+	applied := make([]*models.Coupon, 0, len(reserved))
+	for i := range reserved {
+		applied = append(applied, &reserved[i])
+	}
+	return stackConflict(&coupon, applied), nil
+}
+
+// stackConflict returns why the coupon can not be applied along with the applied coupons, empty if it can
+func stackConflict(coupon *models.Coupon, applied []*models.Coupon) string {
+	for _, other := range applied {
+		if !coupon.Stackable {
+			return fmt.Sprintf("coupon can not be combined with %s", other.CouponCode)
+		}
+		if !other.Stackable {
+			return fmt.Sprintf("%s can not be combined with other coupons", other.CouponCode)
+		}
+		if coupon.ExclusivityGroup != "" && coupon.ExclusivityGroup == other.ExclusivityGroup {
+			return fmt.Sprintf("coupon is exclusive with %s in the %s group", other.CouponCode, coupon.ExclusivityGroup)
+		}
+	}
+	return ""
+}
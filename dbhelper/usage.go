@@ -0,0 +1,364 @@
+package dbhelper
+
+import (
+	"database/sql"
+	"errors"
+	"farmako-coupon-service/discount"
+	"farmako-coupon-service/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrReservationNotFound is returned when there is no active coupon reservation for the order
+var ErrReservationNotFound = errors.New("no active coupon reservation found for the order")
+
+// ErrRedemptionNotFound is returned when there is no used coupon for the order
+var ErrRedemptionNotFound = errors.New("no coupon redemption found for the order")
+
+// ErrAlreadyReserved is returned when the coupon is already reserved or used for the order
+var ErrAlreadyReserved = errors.New("coupon is already reserved for the order")
+
+// ErrPartialRefundWithBudget is returned when a partial refund is reversed for an order using a coupon with a
+// discount budget, the discount kept by the items which are not refunded is not known
+var ErrPartialRefundWithBudget = errors.New("partial refunds can not be reversed for coupons with a discount budget")
+
+// releasedCapacity gives the redemptions and the discount of the usages in the released CTE back to their coupons,
+// it follows a released CTE returning the coupon_id and discount_amount of the usages
+const releasedCapacity = `,
+	released_totals AS (
+		SELECT coupon_id, COUNT(*) AS redemptions, SUM(discount_amount) AS discount FROM released GROUP BY coupon_id
+	),
+	restored AS (
+		UPDATE coupons
+		SET redemptions_used = GREATEST(redemptions_used - released_totals.redemptions, 0),
+			discount_used = GREATEST(discount_used - released_totals.discount, 0)
+		FROM released_totals WHERE coupons.id = released_totals.coupon_id
+	)
+`
+
+// activeUsageCondition matches the usages counted against the user's limit, committed usages
+// and reservations which are not expired yet
+const activeUsageCondition = `(status = 'committed' OR (status = 'reserved' AND expires_at > NOW()))`
+
+// CountActiveUsages returns the number of times the user has used or reserved the coupon.
+// Time based coupons count the usages of the current validity window only.
+func CountActiveUsages(db sqlx.Queryer, coupon *models.Coupon, userID string) (int, error) {
+	usedSince := time.Time{}
+	if coupon.UsageType == models.UsageTypeTimeBased && coupon.ValidFrom != nil {
+		usedSince = *coupon.ValidFrom
+	}
+
+	var count int
+	err := sqlx.Get(db, &count, `
+		SELECT COUNT(*) FROM coupon_usages
+		WHERE coupon_id = $1 AND user_id = $2 AND used_at >= $3 AND `+activeUsageCondition,
+		coupon.ID, userID, usedSince)
+	return count, err
+}
+
+// CountActiveUsagesByCoupon returns the number of times the user has used or reserved every coupon in a single
+// query, counted the same way as CountActiveUsages. Coupons never used by the user are left out.
+func CountActiveUsagesByCoupon(db sqlx.Queryer, userID string) (map[string]int, error) {
+	var counts []struct {
+		CouponID string `db:"coupon_id"`
+		Count    int    `db:"count"`
+	}
+	err := sqlx.Select(db, &counts, `
+		SELECT coupon_id, COUNT(*) AS count FROM coupon_usages
+		WHERE user_id = $1 AND `+activeUsageCondition+` AND used_at >= COALESCE((
+			SELECT valid_from FROM coupons WHERE coupons.id = coupon_usages.coupon_id AND coupons.usage_type = 'time_based'
+		), '-infinity')
+		GROUP BY coupon_id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make(map[string]int, len(counts))
+	for _, count := range counts {
+		usages[count.CouponID] = count.Count
+	}
+	return usages, nil
+}
+
+// ReserveCouponUsage validates the coupon and reserves its usage for the order till expiresAt. It must run
+// inside a transaction, the coupon row and the order stay locked till the end of it so that concurrent
+// reservations of the same coupon are counted one after another and the coupons reserved for an order are
+// checked against each other. The validation result is returned without a reservation if the coupon is not
+// valid or can not be combined with the coupons already reserved for the order.
+func ReserveCouponUsage(db sqlx.Ext, req models.ReserveCouponRequest, expiresAt time.Time) (*models.CouponReservation, *models.ValidationResult, error) {
+	if _, err := db.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, req.OrderID); err != nil {
+		return nil, nil, err
+	}
+
+	var couponID string
+	err := sqlx.Get(db, &couponID, `SELECT id FROM coupons WHERE UPPER(coupon_code) = UPPER($1) FOR UPDATE`, req.CouponCode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Expired reservations of the order which the sweeper has not released yet still hold the unique index
+	if _, err := releaseExpiredOrderReservations(db, req.OrderID); err != nil {
+		return nil, nil, err
+	}
+
+	var count int
+	err = sqlx.Get(db, &count, `
+		SELECT COUNT(*) FROM coupon_usages
+		WHERE coupon_id = $1 AND order_id = $2 AND `+activeUsageCondition,
+		couponID, req.OrderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if count > 0 {
+		return nil, nil, ErrAlreadyReserved
+	}
+
+	result, err := ValidateCoupon(db, req.ValidateCouponRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !result.IsValid {
+		return nil, result, nil
+	}
+
+	// The coupons reserved for the same order follow the same stacking rules as the combined validation
+	message, err := reservedStackConflict(db, couponID, req.OrderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if message != "" {
+		return nil, &models.ValidationResult{IsValid: false, Message: message}, nil
+	}
+
+	// Stacked coupons share the cart, the coupon only reserves the discount left by the coupons reserved before it
+	given, err := reservedOrderDiscount(db, req.OrderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if result = capReservedDiscount(result, given, req.ValidateCouponRequest); !result.IsValid {
+		return nil, result, nil
+	}
+
+	// Take a redemption and the discount out of the remaining capacity, only if they are still available
+	res, err := db.Exec(`
+		UPDATE coupons
+		SET redemptions_used = redemptions_used + 1, discount_used = discount_used + $2
+		WHERE id = $1
+			AND (max_total_redemptions IS NULL OR redemptions_used < max_total_redemptions)
+			AND (discount_budget IS NULL OR discount_used + $2 <= discount_budget)
+	`, couponID, result.Discount.Total())
+	if err != nil {
+		return nil, nil, err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return nil, &models.ValidationResult{IsValid: false, Message: "coupon redemption limit or discount budget is exhausted"}, err
+	}
+
+	var usage models.CouponUsage
+	err = sqlx.Get(db, &usage, `
+		INSERT INTO coupon_usages (coupon_id, user_id, order_id, status, discount_amount, expires_at)
+		VALUES ($1, $2, $3, 'reserved', $4, $5)
+		RETURNING id, coupon_id, user_id, order_id, status, discount_amount, used_at, expires_at
+	`, couponID, req.UserID, req.OrderID, result.Discount.Total(), expiresAt)
+	if err != nil {
+		// Handle unique constraint violation (if concurrent insert)
+		if IsDuplicateKeyError(err) {
+			return nil, nil, ErrAlreadyReserved
+		}
+		return nil, nil, err
+	}
+	for chargeType, amount := range result.Discount.ChargeDiscounts {
+		_, err := db.Exec(`
+			INSERT INTO coupon_usage_charge_discounts (usage_id, charge_type, amount) VALUES ($1, $2, $3)
+		`, usage.ID, chargeType, amount)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return &models.CouponReservation{Usage: usage, Discount: result.Discount}, result, nil
+}
+
+// reservedOrderDiscount returns the discount of the coupons reserved or used for the order, the discount of a usage
+// which is not given on a charge is given on the items
+func reservedOrderDiscount(db sqlx.Queryer, orderID string) (models.DiscountBreakdown, error) {
+	var given models.DiscountBreakdown
+	var total float64
+	err := sqlx.Get(db, &total, `
+		SELECT COALESCE(SUM(discount_amount), 0) FROM coupon_usages WHERE order_id = $1 AND `+activeUsageCondition,
+		orderID)
+	if err != nil {
+		return given, err
+	}
+
+	var charges []struct {
+		ChargeType models.ChargeType `db:"charge_type"`
+		Amount     float64           `db:"amount"`
+	}
+	err = sqlx.Select(db, &charges, `
+		SELECT charge_type, SUM(amount) AS amount FROM coupon_usage_charge_discounts
+		WHERE usage_id IN (SELECT id FROM coupon_usages WHERE order_id = $1 AND `+activeUsageCondition+`)
+		GROUP BY charge_type
+	`, orderID)
+	if err != nil {
+		return given, err
+	}
+
+	if len(charges) > 0 {
+		given.ChargeDiscounts = make(map[models.ChargeType]float64, len(charges))
+	}
+	for _, charge := range charges {
+		given.ChargeDiscounts[charge.ChargeType] = charge.Amount
+		given.ChargesDiscount += charge.Amount
+	}
+	given.ItemsDiscount = discount.Round(total - given.ChargesDiscount)
+	given.ChargesDiscount = discount.Round(given.ChargesDiscount)
+	return given, nil
+}
+
+// capReservedDiscount limits the discount of a valid coupon to what is left of the cart after the discount given by
+// the coupons already reserved for the order, the coupon is not valid if nothing is left
+func capReservedDiscount(result *models.ValidationResult, given models.DiscountBreakdown, req models.ValidateCouponRequest) *models.ValidationResult {
+	remaining := discount.Remaining(result.Discount, given, req)
+	if remaining.Total() <= 0 {
+		return &models.ValidationResult{IsValid: false, Message: "the cart is fully discounted by the other coupons"}
+	}
+
+	capped := *result
+	capped.Discount = remaining
+	return &capped
+}
+
+// CommitCouponReservation marks the active reservations of the order made for the user as used
+func CommitCouponReservation(db sqlx.Execer, orderID, userID string) error {
+	res, err := db.Exec(`
+		UPDATE coupon_usages
+		SET status = 'committed', expires_at = NULL, updated_at = NOW()
+		WHERE order_id = $1 AND user_id = $2 AND status = 'reserved' AND expires_at > NOW()
+	`, orderID, userID)
+	if err != nil {
+		return err
+	}
+	return checkRowsAffected(res, ErrReservationNotFound)
+}
+
+// ReleaseCouponReservation releases the reservations of the order made for the user so that the usages are given
+// back to the user and the redemptions and discount are given back to the coupon
+func ReleaseCouponReservation(db sqlx.Queryer, orderID, userID string) error {
+	var released int64
+	err := sqlx.Get(db, &released, `
+		WITH released AS (
+			UPDATE coupon_usages
+			SET status = 'released', updated_at = NOW()
+			WHERE order_id = $1 AND user_id = $2 AND status = 'reserved'
+			RETURNING coupon_id, discount_amount
+		)`+releasedCapacity+`
+		SELECT COUNT(*) FROM released
+	`, orderID, userID)
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		return ErrReservationNotFound
+	}
+	return nil
+}
+
+// ReleaseExpiredReservations releases the reservations whose TTL has expired by the given time
+// and returns the number of reservations released
+func ReleaseExpiredReservations(db sqlx.Queryer, now time.Time) (int64, error) {
+	var released int64
+	err := sqlx.Get(db, &released, `
+		WITH released AS (
+			UPDATE coupon_usages
+			SET status = 'released', updated_at = NOW()
+			WHERE status = 'reserved' AND expires_at <= $1
+			RETURNING coupon_id, discount_amount
+		)`+releasedCapacity+`
+		SELECT COUNT(*) FROM released
+	`, now)
+	return released, err
+}
+
+// releaseExpiredOrderReservations releases the reservations of the order whose TTL has expired and returns the
+// number of reservations released
+func releaseExpiredOrderReservations(db sqlx.Queryer, orderID string) (int64, error) {
+	var released int64
+	err := sqlx.Get(db, &released, `
+		WITH released AS (
+			UPDATE coupon_usages
+			SET status = 'released', updated_at = NOW()
+			WHERE order_id = $1 AND status = 'reserved' AND expires_at <= NOW()
+			RETURNING coupon_id, discount_amount
+		)`+releasedCapacity+`
+		SELECT COUNT(*) FROM released
+	`, orderID)
+	return released, err
+}
+
+// ReverseCouponUsage reverses the committed coupon usages of the order so that the uses are given back
+// to the user and the coupon, and records the reversal in the history. It must run inside a transaction.
+func ReverseCouponUsage(db sqlx.Ext, req models.ReverseCouponUsageRequest) ([]models.CouponUsageReversal, error) {
+	// A reversal gives the whole discount back to the budget, which overstates the budget left after a partial refund
+	if req.RefundType == models.RefundTypePartial {
+		var hasBudget bool
+		err := sqlx.Get(db, &hasBudget, `
+			SELECT EXISTS (
+				SELECT 1 FROM coupon_usages
+				JOIN coupons ON coupons.id = coupon_usages.coupon_id
+				WHERE coupon_usages.order_id = $1 AND coupon_usages.status = 'committed' AND coupons.discount_budget IS NOT NULL
+			)
+		`, req.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		if hasBudget {
+			return nil, ErrPartialRefundWithBudget
+		}
+	}
+
+	var usages []models.CouponUsage
+	err := sqlx.Select(db, &usages, `
+		WITH released AS (
+			UPDATE coupon_usages
+			SET status = 'reversed', updated_at = NOW()
+			WHERE order_id = $1 AND status = 'committed'
+			RETURNING id, coupon_id, user_id, order_id, status, discount_amount, used_at, expires_at
+		)`+releasedCapacity+`
+		SELECT * FROM released
+	`, req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(usages) == 0 {
+		return nil, ErrRedemptionNotFound
+	}
+
+	reversals := make([]models.CouponUsageReversal, 0, len(usages))
+	for _, usage := range usages {
+		var reversal models.CouponUsageReversal
+		err := sqlx.Get(db, &reversal, `
+			INSERT INTO coupon_usage_reversals (usage_id, coupon_id, user_id, order_id, refund_type, refunded_amount, reason, reversed_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id, usage_id, coupon_id, user_id, order_id, refund_type, refunded_amount, reason, COALESCE(reversed_by, '') AS reversed_by, created_at
+		`, usage.ID, usage.CouponID, usage.UserID, usage.OrderID, req.RefundType, req.RefundedAmount, req.Reason, req.ReversedBy)
+		if err != nil {
+			return nil, err
+		}
+		reversals = append(reversals, reversal)
+	}
+	return reversals, nil
+}
+
+// checkRowsAffected returns notFoundErr if the statement did not change any row
+func checkRowsAffected(res sql.Result, notFoundErr error) error {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return notFoundErr
+	}
+	return nil
+}
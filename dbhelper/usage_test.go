@@ -0,0 +1,88 @@
+package dbhelper
+
+import (
+	"farmako-coupon-service/models"
+	"testing"
+)
+
+func TestCapReservedDiscount(t *testing.T) {
+	cart := models.ValidateCouponRequest{
+		OrderTotal: 600,
+		Charges: []models.Charge{
+			{Type: models.ChargeTypeDelivery, Amount: 50},
+			{Type: models.ChargeTypePackaging, Amount: 20},
+		},
+	}
+	itemsCoupon := models.DiscountBreakdown{ItemsDiscount: 500}
+	deliveryCoupon := models.DiscountBreakdown{
+		ChargesDiscount: 50,
+		ChargeDiscounts: map[models.ChargeType]float64{models.ChargeTypeDelivery: 50},
+	}
+
+	tests := []struct {
+		name      string
+		discount  models.DiscountBreakdown
+		given     models.DiscountBreakdown
+		wantValid bool
+		want      float64
+	}{
+		{
+			name:      "first coupon of the order",
+			discount:  itemsCoupon,
+			wantValid: true,
+			want:      500,
+		},
+		{
+			name:      "second coupon only gets what is left of the cart",
+			discount:  itemsCoupon,
+			given:     models.DiscountBreakdown{ItemsDiscount: 500},
+			wantValid: true,
+			want:      100,
+		},
+		{
+			name:     "cart fully discounted by the other coupons",
+			discount: itemsCoupon,
+			given:    models.DiscountBreakdown{ItemsDiscount: 600},
+		},
+		{
+			name:     "charge discounts do not leave room on the items",
+			discount: deliveryCoupon,
+			given: models.DiscountBreakdown{
+				ItemsDiscount:   600,
+				ChargesDiscount: 50,
+				ChargeDiscounts: map[models.ChargeType]float64{models.ChargeTypeDelivery: 50},
+			},
+		},
+		{
+			name:     "charge discount capped by the discount already given on the charge",
+			discount: deliveryCoupon,
+			given: models.DiscountBreakdown{
+				ChargesDiscount: 30,
+				ChargeDiscounts: map[models.ChargeType]float64{models.ChargeTypeDelivery: 30},
+			},
+			wantValid: true,
+			want:      20,
+		},
+		{
+			name:     "items discounted by the other coupons leave the charges",
+			discount: deliveryCoupon,
+			given: models.DiscountBreakdown{
+				ItemsDiscount:   600,
+				ChargesDiscount: 20,
+				ChargeDiscounts: map[models.ChargeType]float64{models.ChargeTypePackaging: 20},
+			},
+			wantValid: true,
+			want:      50,
+		},
+	}
+	for _, test := range tests {
+		result := capReservedDiscount(&models.ValidationResult{IsValid: true, Discount: test.discount}, test.given, cart)
+		if result.IsValid != test.wantValid {
+			t.Errorf("%s: valid = %v (%s), want %v", test.name, result.IsValid, result.Message, test.wantValid)
+			continue
+		}
+		if result.IsValid && result.Discount.Total() != test.want {
+			t.Errorf("%s: discount = %v, want %v", test.name, result.Discount.Total(), test.want)
+		}
+	}
+}
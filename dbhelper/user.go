@@ -0,0 +1,48 @@
+package dbhelper
+
+import (
+	"farmako-coupon-service/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// GetUserContext fetches the stored context of the user along with their segments, sql.ErrNoRows is returned
+// if the user has no profile
+func GetUserContext(db sqlx.Queryer, userID string) (*models.UserContext, error) {
+	var user models.UserContext
+	err := sqlx.Get(db, &user, `SELECT user_id, order_count, signed_up_at FROM user_profiles WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Segments = []string{}
+	err = sqlx.Select(db, &user.Segments, `SELECT segment FROM user_segments WHERE user_id = $1 ORDER BY segment`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpsertUserContext creates or replaces the stored context of the user, the segments are replaced as a whole.
+// It must run inside a transaction.
+func UpsertUserContext(db sqlx.Ext, user models.UserContext) error {
+	_, err := db.Exec(`
+		INSERT INTO user_profiles (user_id, order_count, signed_up_at) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET order_count = EXCLUDED.order_count, signed_up_at = EXCLUDED.signed_up_at, updated_at = NOW()
+	`, user.UserID, user.OrderCount, user.SignupDate)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(`DELETE FROM user_segments WHERE user_id = $1`, user.UserID); err != nil {
+		return err
+	}
+	for _, segment := range user.Segments {
+		_, err := db.Exec(`INSERT INTO user_segments (user_id, segment) VALUES ($1, $2)`, user.UserID, segment)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
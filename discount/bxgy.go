@@ -0,0 +1,86 @@
+package discount
+
+import (
+	"farmako-coupon-service/models"
+	"fmt"
+	"sort"
+)
+
+// FreeUnitsDiscount returns the price of the units a buy x get y coupon gives free on the cart.
+// Without a reward medicine every buy + get qualifying units make the cheapest get units free. With a reward
+// medicine every buy qualifying units make get units of the reward medicine free, when the reward medicine
+// qualifies itself it has to be bought along, so every buy + get units make get reward units free.
+func FreeUnitsDiscount(coupon *models.Coupon, cartItems []models.CartItem) float64 {
+	if coupon.BuyQuantity <= 0 || coupon.GetQuantity <= 0 {
+		return 0
+	}
+
+	eligibleItems := EligibleItems(coupon, cartItems)
+	var qualifyingUnits int
+	for _, item := range eligibleItems {
+		qualifyingUnits += item.Units()
+	}
+
+	if coupon.RewardMedicineID == "" {
+		freeUnits := qualifyingUnits / (coupon.BuyQuantity + coupon.GetQuantity) * coupon.GetQuantity
+		return Round(cheapestUnitsPrice(eligibleItems, freeUnits))
+	}
+
+	var rewardUnits int
+	var rewardPrice float64
+	for _, item := range cartItems {
+		if item.ID == coupon.RewardMedicineID {
+			rewardUnits += item.Units()
+			rewardPrice = item.Price
+		}
+	}
+
+	rewardQualifies := false
+	for _, item := range eligibleItems {
+		if item.ID == coupon.RewardMedicineID {
+			rewardQualifies = true
+		}
+	}
+
+	var freeUnits int
+	if rewardQualifies {
+		freeUnits = qualifyingUnits / (coupon.BuyQuantity + coupon.GetQuantity) * coupon.GetQuantity
+	} else {
+		freeUnits = qualifyingUnits / coupon.BuyQuantity * coupon.GetQuantity
+	}
+	if freeUnits > rewardUnits {
+		freeUnits = rewardUnits
+	}
+	return Round(float64(freeUnits) * rewardPrice)
+}
+
+// BuyXGetYRequirement returns what the cart needs for a buy x get y coupon to give any free unit
+func BuyXGetYRequirement(coupon *models.Coupon) string {
+	if coupon.RewardMedicineID == "" {
+		return fmt.Sprintf("buy %d qualifying items to get %d free", coupon.BuyQuantity+coupon.GetQuantity, coupon.GetQuantity)
+	}
+	return fmt.Sprintf("buy %d qualifying items and add %s to the cart to get %d free", coupon.BuyQuantity, coupon.RewardMedicineID, coupon.GetQuantity)
+}
+
+// cheapestUnitsPrice returns the total price of the given number of the cheapest units of the items
+func cheapestUnitsPrice(items []models.CartItem, units int) float64 {
+	sorted := make([]models.CartItem, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Price < sorted[j].Price
+	})
+
+	var total float64
+	for _, item := range sorted {
+		if units <= 0 {
+			break
+		}
+		taken := item.Units()
+		if taken > units {
+			taken = units
+		}
+		total += float64(taken) * item.Price
+		units -= taken
+	}
+	return total
+}
@@ -0,0 +1,93 @@
+package discount
+
+import (
+	"farmako-coupon-service/models"
+	"testing"
+)
+
+func TestFreeUnitsDiscount(t *testing.T) {
+	tests := []struct {
+		name   string
+		coupon models.Coupon
+		cart   []models.CartItem
+		want   float64
+	}{
+		{
+			name:   "cheapest units are free",
+			coupon: models.Coupon{BuyQuantity: 2, GetQuantity: 1},
+			cart:   []models.CartItem{{ID: "a", Price: 100, Quantity: 2}, {ID: "b", Price: 50, Quantity: 1}},
+			want:   50,
+		},
+		{
+			name:   "not enough units",
+			coupon: models.Coupon{BuyQuantity: 2, GetQuantity: 1},
+			cart:   []models.CartItem{{ID: "a", Price: 100, Quantity: 2}},
+			want:   0,
+		},
+		{
+			name:   "free units span the cheapest items",
+			coupon: models.Coupon{BuyQuantity: 2, GetQuantity: 2},
+			cart:   []models.CartItem{{ID: "a", Price: 30, Quantity: 6}, {ID: "b", Price: 10, Quantity: 1}, {ID: "c", Price: 20, Quantity: 1}},
+			want:   10 + 20 + 30 + 30,
+		},
+		{
+			name:   "item without quantity counts as one unit",
+			coupon: models.Coupon{BuyQuantity: 1, GetQuantity: 1},
+			cart:   []models.CartItem{{ID: "a", Price: 40}, {ID: "b", Price: 25}},
+			want:   25,
+		},
+		{
+			name:   "only applicable medicines qualify",
+			coupon: models.Coupon{BuyQuantity: 2, GetQuantity: 1, ApplicableMedicineIDs: []string{"a"}},
+			cart:   []models.CartItem{{ID: "a", Price: 30, Quantity: 3}, {ID: "b", Price: 5, Quantity: 3}},
+			want:   30,
+		},
+		{
+			name:   "reward medicine outside the qualifying items",
+			coupon: models.Coupon{BuyQuantity: 2, GetQuantity: 1, ApplicableMedicineIDs: []string{"a"}, RewardMedicineID: "r"},
+			cart:   []models.CartItem{{ID: "a", Price: 20, Quantity: 4}, {ID: "r", Price: 15, Quantity: 3}},
+			want:   30,
+		},
+		{
+			name:   "free units capped by the reward units in the cart",
+			coupon: models.Coupon{BuyQuantity: 2, GetQuantity: 1, ApplicableMedicineIDs: []string{"a"}, RewardMedicineID: "r"},
+			cart:   []models.CartItem{{ID: "a", Price: 20, Quantity: 4}, {ID: "r", Price: 15, Quantity: 1}},
+			want:   15,
+		},
+		{
+			name:   "reward medicine missing from the cart",
+			coupon: models.Coupon{BuyQuantity: 2, GetQuantity: 1, ApplicableMedicineIDs: []string{"a"}, RewardMedicineID: "r"},
+			cart:   []models.CartItem{{ID: "a", Price: 20, Quantity: 4}},
+			want:   0,
+		},
+		{
+			name:   "reward medicine qualifying itself has to be bought along",
+			coupon: models.Coupon{BuyQuantity: 2, GetQuantity: 1, ApplicableMedicineIDs: []string{"a"}, RewardMedicineID: "a"},
+			cart:   []models.CartItem{{ID: "a", Price: 20, Quantity: 5}},
+			want:   20,
+		},
+		{
+			name:   "free units are rounded",
+			coupon: models.Coupon{BuyQuantity: 1, GetQuantity: 1},
+			cart:   []models.CartItem{{ID: "a", Price: 33.333, Quantity: 2}},
+			want:   33.33,
+		},
+		{
+			name:   "missing buy quantity",
+			coupon: models.Coupon{GetQuantity: 1},
+			cart:   []models.CartItem{{ID: "a", Price: 20, Quantity: 4}},
+			want:   0,
+		},
+		{
+			name:   "missing get quantity",
+			coupon: models.Coupon{BuyQuantity: 1},
+			cart:   []models.CartItem{{ID: "a", Price: 20, Quantity: 4}},
+			want:   0,
+		},
+	}
+	for _, test := range tests {
+		if got := FreeUnitsDiscount(&test.coupon, test.cart); got != test.want {
+			t.Errorf("%s: FreeUnitsDiscount = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package discount
+
+import (
+	"farmako-coupon-service/models"
+	"math"
+)
+
+// Calculate computes the discount a coupon gives for the given request
+func Calculate(coupon *models.Coupon, req models.ValidateCouponRequest) models.DiscountBreakdown {
+	var breakdown models.DiscountBreakdown
+	switch coupon.Target {
+	case models.TargetInventory:
+		if coupon.DiscountType == models.DiscountTypeBuyXGetY {
+			breakdown.ItemsDiscount = Cap(FreeUnitsDiscount(coupon, req.CartItems), coupon.MaxDiscountAmount)
+			break
+		}
+		if coupon.DiscountType == models.DiscountTypeTiered {
+			breakdown.ItemsDiscount = Cap(TieredDiscount(coupon, EligibleSubtotal(coupon, req)), coupon.MaxDiscountAmount)
+			break
+		}
+		breakdown.ItemsDiscount = Cap(Amount(coupon.DiscountType, coupon.DiscountValue, EligibleSubtotal(coupon, req)), coupon.MaxDiscountAmount)
+	case models.TargetCharges:
+		breakdown.ChargeDiscounts = ChargeDiscounts(coupon, req.Charges)
+		for _, amount := range breakdown.ChargeDiscounts {
+			breakdown.ChargesDiscount += amount
+		}
+		breakdown.ChargesDiscount = Round(breakdown.ChargesDiscount)
+	}
+	return breakdown
+}
+
+// IsRestricted returns true if the coupon is only applicable to specific medicines or categories
+func IsRestricted(coupon *models.Coupon) bool {
+	return len(coupon.ApplicableMedicineIDs) > 0 || len(coupon.ApplicableCategories) > 0
+}
+
+// EligibleItems returns the cart items matching the applicable medicines or categories of the coupon
+func EligibleItems(coupon *models.Coupon, cartItems []models.CartItem) []models.CartItem {
+	if !IsRestricted(coupon) {
+		return cartItems
+	}
+
+	medicines := make(map[string]bool, len(coupon.ApplicableMedicineIDs))
+	for _, medicineID := range coupon.ApplicableMedicineIDs {
+		medicines[medicineID] = true
+	}
+	categories := make(map[string]bool, len(coupon.ApplicableCategories))
+	for _, category := range coupon.ApplicableCategories {
+		categories[category] = true
+	}
+
+	eligibleItems := make([]models.CartItem, 0, len(cartItems))
+	for _, item := range cartItems {
+		if medicines[item.ID] || categories[item.Category] {
+			eligibleItems = append(eligibleItems, item)
+		}
+	}
+	return eligibleItems
+}
+
+// EligibleSubtotal returns the amount of the cart the coupon discount is calculated on.
+// Coupons without any medicine or category restriction are applicable on the whole order.
+func EligibleSubtotal(coupon *models.Coupon, req models.ValidateCouponRequest) float64 {
+	if !IsRestricted(coupon) && req.OrderTotal > 0 {
+		return req.OrderTotal
+	}
+
+	var subtotal float64
+	for _, item := range EligibleItems(coupon, req.CartItems) {
+		subtotal += item.LineTotal()
+	}
+	return subtotal
+}
+
+// Amount returns the discount for a base amount, percentage discounts are calculated
+// against the base while fixed discounts are taken as is. The discount never exceeds the base.
+func Amount(discountType string, discountValue, base float64) float64 {
+	if base <= 0 || discountValue <= 0 {
+		return 0
+	}
+
+	var amount float64
+	switch discountType {
+	case models.DiscountTypePercentage:
+		amount = base * discountValue / 100
+	case models.DiscountTypeFixed:
+		amount = discountValue
+	}
+	return Round(math.Min(amount, base))
+}
+
+// Cap limits the discount to the max discount amount, zero means no cap
+func Cap(amount, maxDiscountAmount float64) float64 {
+	if maxDiscountAmount > 0 && amount > maxDiscountAmount {
+		return maxDiscountAmount
+	}
+	return amount
+}
+
+// Round rounds off the amount to two decimal places
+func Round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,123 @@
+package discount
+
+import (
+	"farmako-coupon-service/models"
+	"testing"
+)
+
+func TestAmount(t *testing.T) {
+	tests := []struct {
+		discountType  string
+		discountValue float64
+		base          float64
+		want          float64
+	}{
+		{models.DiscountTypePercentage, 10, 500, 50},
+		{models.DiscountTypePercentage, 100, 500, 500},
+		{models.DiscountTypePercentage, 12.5, 99.99, 12.5},
+		{models.DiscountTypePercentage, 33, 10.01, 3.3},
+		{models.DiscountTypeFixed, 100, 500, 100},
+		{models.DiscountTypeFixed, 100, 60, 60},
+		{models.DiscountTypeFixed, 10.555, 500, 10.56},
+		{models.DiscountTypePercentage, 10, 0, 0},
+		{models.DiscountTypeFixed, 100, -5, 0},
+		{models.DiscountTypePercentage, 0, 500, 0},
+		{models.DiscountTypeBuyXGetY, 10, 500, 0},
+	}
+	for _, test := range tests {
+		if got := Amount(test.discountType, test.discountValue, test.base); got != test.want {
+			t.Errorf("Amount(%s, %v, %v) = %v, want %v", test.discountType, test.discountValue, test.base, got, test.want)
+		}
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	cart := []models.CartItem{
+		{ID: "med_123", Category: "fever", Price: 120, Quantity: 2},
+		{ID: "med_456", Category: "vitamins", Price: 60.5, Quantity: 1},
+	}
+	tests := []struct {
+		name   string
+		coupon models.Coupon
+		req    models.ValidateCouponRequest
+		want   float64
+	}{
+		{
+			name:   "percentage of the order total",
+			coupon: models.Coupon{Target: models.TargetInventory, DiscountType: models.DiscountTypePercentage, DiscountValue: 10},
+			req:    models.ValidateCouponRequest{OrderTotal: 1000, CartItems: cart},
+			want:   100,
+		},
+		{
+			name: "percentage capped by the max discount amount",
+			coupon: models.Coupon{
+				Target: models.TargetInventory, DiscountType: models.DiscountTypePercentage, DiscountValue: 50, MaxDiscountAmount: 150,
+			},
+			req:  models.ValidateCouponRequest{OrderTotal: 1000, CartItems: cart},
+			want: 150,
+		},
+		{
+			name: "percentage below the max discount amount",
+			coupon: models.Coupon{
+				Target: models.TargetInventory, DiscountType: models.DiscountTypePercentage, DiscountValue: 10, MaxDiscountAmount: 150,
+			},
+			req:  models.ValidateCouponRequest{OrderTotal: 1000, CartItems: cart},
+			want: 100,
+		},
+		{
+			name:   "fixed above the subtotal",
+			coupon: models.Coupon{Target: models.TargetInventory, DiscountType: models.DiscountTypeFixed, DiscountValue: 500},
+			req:    models.ValidateCouponRequest{OrderTotal: 300.5, CartItems: cart},
+			want:   300.5,
+		},
+		{
+			name:   "cart total without an order total",
+			coupon: models.Coupon{Target: models.TargetInventory, DiscountType: models.DiscountTypePercentage, DiscountValue: 15},
+			req:    models.ValidateCouponRequest{CartItems: cart},
+			want:   45.08,
+		},
+		{
+			name: "percentage of the eligible items only",
+			coupon: models.Coupon{
+				Target: models.TargetInventory, DiscountType: models.DiscountTypePercentage, DiscountValue: 7,
+				ApplicableCategories: []string{"vitamins"},
+			},
+			req:  models.ValidateCouponRequest{OrderTotal: 1000, CartItems: cart},
+			want: 4.24,
+		},
+		{
+			name: "fixed above the eligible items",
+			coupon: models.Coupon{
+				Target: models.TargetInventory, DiscountType: models.DiscountTypeFixed, DiscountValue: 100,
+				ApplicableMedicineIDs: []string{"med_456"},
+			},
+			req:  models.ValidateCouponRequest{OrderTotal: 1000, CartItems: cart},
+			want: 60.5,
+		},
+	}
+	for _, test := range tests {
+		breakdown := Calculate(&test.coupon, test.req)
+		if breakdown.ItemsDiscount != test.want || breakdown.ChargesDiscount != 0 {
+			t.Errorf("%s: Calculate = %+v, want an items discount of %v", test.name, breakdown, test.want)
+		}
+	}
+}
+
+func TestCap(t *testing.T) {
+	tests := []struct {
+		amount            float64
+		maxDiscountAmount float64
+		want              float64
+	}{
+		{amount: 250, maxDiscountAmount: 100, want: 100},
+		{amount: 100, maxDiscountAmount: 100, want: 100},
+		{amount: 99.99, maxDiscountAmount: 100, want: 99.99},
+		{amount: 250, maxDiscountAmount: 0, want: 250},
+		{amount: 0, maxDiscountAmount: 100, want: 0},
+	}
+	for _, test := range tests {
+		if got := Cap(test.amount, test.maxDiscountAmount); got != test.want {
+			t.Errorf("Cap(%v, %v) = %v, want %v", test.amount, test.maxDiscountAmount, got, test.want)
+		}
+	}
+}
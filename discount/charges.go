@@ -0,0 +1,54 @@
+package discount
+
+import (
+	"farmako-coupon-service/models"
+	"math"
+)
+
+// EligibleCharges returns the order charges matching the applicable charge types of the coupon.
+// Coupons without any charge type are applicable on all the charges.
+func EligibleCharges(coupon *models.Coupon, charges []models.Charge) []models.Charge {
+	if len(coupon.ApplicableCharges) == 0 {
+		return charges
+	}
+
+	chargeTypes := make(map[models.ChargeType]bool, len(coupon.ApplicableCharges))
+	for _, chargeType := range coupon.ApplicableCharges {
+		chargeTypes[chargeType] = true
+	}
+
+	eligibleCharges := make([]models.Charge, 0, len(charges))
+	for _, charge := range charges {
+		if chargeTypes[charge.Type] && charge.Amount > 0 {
+			eligibleCharges = append(eligibleCharges, charge)
+		}
+	}
+	return eligibleCharges
+}
+
+// ChargeDiscounts calculates the discount on each eligible charge of the order. Percentage discounts
+// are applied on every charge while a fixed discount is consumed charge by charge in the given order.
+// The max discount amount of the coupon is consumed charge by charge as well.
+func ChargeDiscounts(coupon *models.Coupon, charges []models.Charge) map[models.ChargeType]float64 {
+	discounts := make(map[models.ChargeType]float64)
+	remaining := coupon.DiscountValue
+	remainingCap := coupon.MaxDiscountAmount
+	for _, charge := range EligibleCharges(coupon, charges) {
+		var amount float64
+		switch coupon.DiscountType {
+		case models.DiscountTypePercentage:
+			amount = Amount(coupon.DiscountType, coupon.DiscountValue, charge.Amount)
+		case models.DiscountTypeFixed:
+			amount = Round(math.Min(remaining, charge.Amount))
+			remaining -= amount
+		}
+		if coupon.MaxDiscountAmount > 0 {
+			amount = Round(math.Min(amount, remainingCap))
+			remainingCap -= amount
+		}
+		if amount > 0 {
+			discounts[charge.Type] += amount
+		}
+	}
+	return discounts
+}
@@ -0,0 +1,79 @@
+package discount
+
+import (
+	"farmako-coupon-service/models"
+	"reflect"
+	"testing"
+)
+
+func TestChargeDiscounts(t *testing.T) {
+	charges := []models.Charge{
+		{Type: models.ChargeTypeDelivery, Amount: 50},
+		{Type: models.ChargeTypePackaging, Amount: 20},
+		{Type: models.ChargeTypePlatform, Amount: 10},
+	}
+	tests := []struct {
+		name   string
+		coupon models.Coupon
+		want   map[models.ChargeType]float64
+	}{
+		{
+			name:   "percentage on every charge",
+			coupon: models.Coupon{DiscountType: models.DiscountTypePercentage, DiscountValue: 50},
+			want: map[models.ChargeType]float64{
+				models.ChargeTypeDelivery: 25, models.ChargeTypePackaging: 10, models.ChargeTypePlatform: 5,
+			},
+		},
+		{
+			name:   "percentage cap consumed charge by charge",
+			coupon: models.Coupon{DiscountType: models.DiscountTypePercentage, DiscountValue: 50, MaxDiscountAmount: 30},
+			want: map[models.ChargeType]float64{
+				models.ChargeTypeDelivery: 25, models.ChargeTypePackaging: 5,
+			},
+		},
+		{
+			name:   "cap exactly consumed by the first charge",
+			coupon: models.Coupon{DiscountType: models.DiscountTypePercentage, DiscountValue: 100, MaxDiscountAmount: 50},
+			want: map[models.ChargeType]float64{
+				models.ChargeTypeDelivery: 50,
+			},
+		},
+		{
+			name:   "fixed discount consumed charge by charge",
+			coupon: models.Coupon{DiscountType: models.DiscountTypeFixed, DiscountValue: 60},
+			want: map[models.ChargeType]float64{
+				models.ChargeTypeDelivery: 50, models.ChargeTypePackaging: 10,
+			},
+		},
+		{
+			name:   "fixed discount split by the cap",
+			coupon: models.Coupon{DiscountType: models.DiscountTypeFixed, DiscountValue: 100, MaxDiscountAmount: 55},
+			want: map[models.ChargeType]float64{
+				models.ChargeTypeDelivery: 50, models.ChargeTypePackaging: 5,
+			},
+		},
+		{
+			name: "cap shared by the applicable charges only",
+			coupon: models.Coupon{
+				DiscountType: models.DiscountTypePercentage, DiscountValue: 100, MaxDiscountAmount: 25,
+				ApplicableCharges: []models.ChargeType{models.ChargeTypePackaging, models.ChargeTypePlatform},
+			},
+			want: map[models.ChargeType]float64{
+				models.ChargeTypePackaging: 20, models.ChargeTypePlatform: 5,
+			},
+		},
+		{
+			name: "applicable charge missing from the order",
+			coupon: models.Coupon{
+				DiscountType: models.DiscountTypePercentage, DiscountValue: 50,
+				ApplicableCharges: []models.ChargeType{models.ChargeTypeConvenience},
+			},
+			want: map[models.ChargeType]float64{},
+		},
+	}
+	for _, test := range tests {
+		if got := ChargeDiscounts(&test.coupon, charges); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: ChargeDiscounts = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package discount
+
+import (
+	"farmako-coupon-service/models"
+	"math"
+)
+
+// Remaining limits the discount of a coupon to what is left of the cart after the discount already given
+// by the other coupons, so that stacked coupons never discount the items or a charge beyond its amount
+func Remaining(breakdown, given models.DiscountBreakdown, req models.ValidateCouponRequest) models.DiscountBreakdown {
+	itemsBase := req.OrderTotal
+	if itemsBase <= 0 {
+		for _, item := range req.CartItems {
+			itemsBase += item.LineTotal()
+		}
+	}
+
+	remaining := models.DiscountBreakdown{
+		ItemsDiscount: Round(math.Max(math.Min(breakdown.ItemsDiscount, itemsBase-given.ItemsDiscount), 0)),
+	}
+	if len(breakdown.ChargeDiscounts) == 0 {
+		return remaining
+	}
+
+	chargeAmounts := make(map[models.ChargeType]float64, len(req.Charges))
+	for _, charge := range req.Charges {
+		chargeAmounts[charge.Type] += charge.Amount
+	}
+
+	remaining.ChargeDiscounts = make(map[models.ChargeType]float64)
+	for chargeType, amount := range breakdown.ChargeDiscounts {
+		amount = Round(math.Min(amount, chargeAmounts[chargeType]-given.ChargeDiscounts[chargeType]))
+		if amount > 0 {
+			remaining.ChargeDiscounts[chargeType] = amount
+			remaining.ChargesDiscount += amount
+		}
+	}
+	remaining.ChargesDiscount = Round(remaining.ChargesDiscount)
+	return remaining
+}
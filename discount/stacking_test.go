@@ -0,0 +1,98 @@
+package discount
+
+import (
+	"farmako-coupon-service/models"
+	"reflect"
+	"testing"
+)
+
+func TestRemaining(t *testing.T) {
+	order := models.ValidateCouponRequest{
+		OrderTotal: 600,
+		Charges: []models.Charge{
+			{Type: models.ChargeTypeDelivery, Amount: 50},
+			{Type: models.ChargeTypePackaging, Amount: 20},
+		},
+	}
+	delivery := func(amount float64) models.DiscountBreakdown {
+		return models.DiscountBreakdown{
+			ChargesDiscount: amount,
+			ChargeDiscounts: map[models.ChargeType]float64{models.ChargeTypeDelivery: amount},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		breakdown models.DiscountBreakdown
+		given     models.DiscountBreakdown
+		req       models.ValidateCouponRequest
+		want      models.DiscountBreakdown
+	}{
+		{
+			name:      "nothing given yet",
+			breakdown: models.DiscountBreakdown{ItemsDiscount: 500},
+			req:       order,
+			want:      models.DiscountBreakdown{ItemsDiscount: 500},
+		},
+		{
+			name:      "items discount capped by what is left of the order",
+			breakdown: models.DiscountBreakdown{ItemsDiscount: 500},
+			given:     models.DiscountBreakdown{ItemsDiscount: 500},
+			req:       order,
+			want:      models.DiscountBreakdown{ItemsDiscount: 100},
+		},
+		{
+			name:      "order fully discounted",
+			breakdown: models.DiscountBreakdown{ItemsDiscount: 500},
+			given:     models.DiscountBreakdown{ItemsDiscount: 600},
+			req:       order,
+			want:      models.DiscountBreakdown{},
+		},
+		{
+			name:      "order discounted beyond its total",
+			breakdown: models.DiscountBreakdown{ItemsDiscount: 500},
+			given:     models.DiscountBreakdown{ItemsDiscount: 700},
+			req:       order,
+			want:      models.DiscountBreakdown{},
+		},
+		{
+			name:      "cart items without an order total",
+			breakdown: models.DiscountBreakdown{ItemsDiscount: 500},
+			given:     models.DiscountBreakdown{ItemsDiscount: 50.25},
+			req:       models.ValidateCouponRequest{CartItems: []models.CartItem{{ID: "med_123", Price: 100, Quantity: 2}}},
+			want:      models.DiscountBreakdown{ItemsDiscount: 149.75},
+		},
+		{
+			name:      "charge discount capped by what is left of the charge",
+			breakdown: delivery(50),
+			given:     delivery(30),
+			req:       order,
+			want:      delivery(20),
+		},
+		{
+			name:      "charges are not consumed by the items discount",
+			breakdown: delivery(50),
+			given:     models.DiscountBreakdown{ItemsDiscount: 600},
+			req:       order,
+			want:      delivery(50),
+		},
+		{
+			name:      "charge fully discounted",
+			breakdown: delivery(50),
+			given:     delivery(50),
+			req:       order,
+			want:      models.DiscountBreakdown{ChargeDiscounts: map[models.ChargeType]float64{}},
+		},
+		{
+			name:      "charge missing from the order",
+			breakdown: delivery(50),
+			req:       models.ValidateCouponRequest{OrderTotal: 600},
+			want:      models.DiscountBreakdown{ChargeDiscounts: map[models.ChargeType]float64{}},
+		},
+	}
+	for _, test := range tests {
+		if got := Remaining(test.breakdown, test.given, test.req); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Remaining = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
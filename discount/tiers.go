@@ -0,0 +1,55 @@
+package discount
+
+import "farmako-coupon-service/models"
+
+// ApplicableTier returns the highest tier reached by the eligible subtotal, nil if the subtotal is below all the tiers
+func ApplicableTier(coupon *models.Coupon, subtotal float64) *models.DiscountTier {
+	var applicable *models.DiscountTier
+	for i := range coupon.DiscountTiers {
+		tier := &coupon.DiscountTiers[i]
+		if subtotal >= tier.MinSubtotal && (applicable == nil || tier.MinSubtotal > applicable.MinSubtotal) {
+			applicable = tier
+		}
+	}
+	return applicable
+}
+
+// LowestTier returns the tier with the lowest min subtotal, nil if the coupon has no tiers
+func LowestTier(coupon *models.Coupon) *models.DiscountTier {
+	var lowest *models.DiscountTier
+	for i := range coupon.DiscountTiers {
+		if tier := &coupon.DiscountTiers[i]; lowest == nil || tier.MinSubtotal < lowest.MinSubtotal {
+			lowest = tier
+		}
+	}
+	return lowest
+}
+
+// NextTier returns the lowest tier above the eligible subtotal along with the amount left to reach it,
+// nil for coupons which are not tiered or when the highest tier is already reached
+func NextTier(coupon *models.Coupon, subtotal float64) *models.NextDiscountTier {
+	if coupon.DiscountType != models.DiscountTypeTiered {
+		return nil
+	}
+
+	var next *models.DiscountTier
+	for i := range coupon.DiscountTiers {
+		tier := &coupon.DiscountTiers[i]
+		if tier.MinSubtotal > subtotal && (next == nil || tier.MinSubtotal < next.MinSubtotal) {
+			next = tier
+		}
+	}
+	if next == nil {
+		return nil
+	}
+	return &models.NextDiscountTier{DiscountTier: *next, Shortfall: Round(next.MinSubtotal - subtotal)}
+}
+
+// TieredDiscount returns the discount of the highest tier reached by the eligible subtotal
+func TieredDiscount(coupon *models.Coupon, subtotal float64) float64 {
+	tier := ApplicableTier(coupon, subtotal)
+	if tier == nil {
+		return 0
+	}
+	return Amount(tier.DiscountType, tier.DiscountValue, subtotal)
+}
@@ -0,0 +1,75 @@
+package discount
+
+import (
+	"farmako-coupon-service/models"
+	"testing"
+)
+
+// tieredCoupon has its tiers out of order on purpose, the tiers are not sorted when loaded
+var tieredCoupon = models.Coupon{
+	DiscountType: models.DiscountTypeTiered,
+	DiscountTiers: []models.DiscountTier{
+		{MinSubtotal: 1000, DiscountType: models.DiscountTypePercentage, DiscountValue: 10},
+		{MinSubtotal: 500, DiscountType: models.DiscountTypePercentage, DiscountValue: 5},
+		{MinSubtotal: 2000, DiscountType: models.DiscountTypeFixed, DiscountValue: 300},
+	},
+}
+
+func TestTieredDiscount(t *testing.T) {
+	tests := []struct {
+		subtotal      float64
+		wantTier      float64
+		wantDiscount  float64
+		wantNextTier  float64
+		wantShortfall float64
+	}{
+		{subtotal: 0, wantNextTier: 500, wantShortfall: 500},
+		{subtotal: 400.5, wantNextTier: 500, wantShortfall: 99.5},
+		{subtotal: 500, wantTier: 500, wantDiscount: 25, wantNextTier: 1000, wantShortfall: 500},
+		{subtotal: 999.99, wantTier: 500, wantDiscount: 50, wantNextTier: 1000, wantShortfall: 0.01},
+		{subtotal: 1500, wantTier: 1000, wantDiscount: 150, wantNextTier: 2000, wantShortfall: 500},
+		{subtotal: 2000, wantTier: 2000, wantDiscount: 300},
+		{subtotal: 5000, wantTier: 2000, wantDiscount: 300},
+	}
+	for _, test := range tests {
+		tier := ApplicableTier(&tieredCoupon, test.subtotal)
+		switch {
+		case test.wantTier == 0 && tier != nil:
+			t.Errorf("ApplicableTier(%v) = %v, want nil", test.subtotal, tier.MinSubtotal)
+		case test.wantTier != 0 && (tier == nil || tier.MinSubtotal != test.wantTier):
+			t.Errorf("ApplicableTier(%v) = %v, want %v", test.subtotal, tier, test.wantTier)
+		}
+
+		if got := TieredDiscount(&tieredCoupon, test.subtotal); got != test.wantDiscount {
+			t.Errorf("TieredDiscount(%v) = %v, want %v", test.subtotal, got, test.wantDiscount)
+		}
+
+		next := NextTier(&tieredCoupon, test.subtotal)
+		switch {
+		case test.wantNextTier == 0 && next != nil:
+			t.Errorf("NextTier(%v) = %v, want nil", test.subtotal, next.MinSubtotal)
+		case test.wantNextTier != 0 && next == nil:
+			t.Errorf("NextTier(%v) = nil, want %v", test.subtotal, test.wantNextTier)
+		case next != nil && (next.MinSubtotal != test.wantNextTier || next.Shortfall != test.wantShortfall):
+			t.Errorf("NextTier(%v) = %v short by %v, want %v short by %v",
+				test.subtotal, next.MinSubtotal, next.Shortfall, test.wantNextTier, test.wantShortfall)
+		}
+	}
+}
+
+func TestLowestTier(t *testing.T) {
+	if tier := LowestTier(&tieredCoupon); tier == nil || tier.MinSubtotal != 500 {
+		t.Errorf("LowestTier = %v, want the tier of 500", tier)
+	}
+	if tier := LowestTier(&models.Coupon{}); tier != nil {
+		t.Errorf("LowestTier without tiers = %v, want nil", tier)
+	}
+}
+
+func TestNextTierNotTiered(t *testing.T) {
+	coupon := tieredCoupon
+	coupon.DiscountType = models.DiscountTypePercentage
+	if next := NextTier(&coupon, 100); next != nil {
+		t.Errorf("NextTier of a percentage coupon = %v, want nil", next)
+	}
+}
@@ -18,7 +18,171 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/v1/admin/campaigns": {
+            "post": {
+                "description": "Creates a campaign generating the given number of unique codes, every code is a coupon sharing the rules of the campaign coupon. A code can be redeemed once in total unless the campaign coupon sets a bigger max_total_redemptions. The codes can be exported as CSV.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Create a coupon campaign",
+                "parameters": [
+                    {
+                        "description": "Campaign Payload",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CreateCampaignRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.CouponCampaign"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/RequestErr"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/v1/admin/campaigns/{id}/codes": {
+            "get": {
+                "description": "Streams the generated codes of the campaign as CSV",
+                "produces": [
+                    "text/csv"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Export the codes of a campaign",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Campaign ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
         "/v1/admin/coupons": {
+            "get": {
+                "description": "Returns a page of the coupons matching the filters, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "List coupons",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Coupon code prefix",
+                        "name": "code",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Status (draft, active, paused, archived)",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Target (inventory, charges)",
+                        "name": "target",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Discount type",
+                        "name": "discount_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Usage type",
+                        "name": "usage_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expiry date lower bound (RFC3339)",
+                        "name": "expires_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expiry date upper bound (RFC3339)",
+                        "name": "expires_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Coupons usable at the time (RFC3339)",
+                        "name": "active_at",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size, 20 by default and 100 at most",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page offset",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.CouponList"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
             "post": {
                 "description": "Admin creates a coupon with the required fields.",
                 "consumes": [
@@ -49,49 +213,118 @@ const docTemplate = `{
                     "400": {
                         "description": "Bad Request"
                     },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/RequestErr"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error"
                     }
                 }
             }
         },
-        "/v1/public/coupons/applicable": {
+        "/v1/admin/coupons/export": {
+            "get": {
+                "description": "Streams all the coupons matching the filters with their applicable medicines, categories, charges and usage counts as CSV or NDJSON. Lists are separated by | in the CSV. discount_given is the discount of the committed redemptions.",
+                "produces": [
+                    "text/csv",
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Export coupons",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "csv (default) or ndjson",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Status (draft, active, paused, archived)",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Target (inventory, charges)",
+                        "name": "target",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expiry date lower bound (RFC3339)",
+                        "name": "expires_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expiry date upper bound (RFC3339)",
+                        "name": "expires_before",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    }
+                }
+            }
+        },
+        "/v1/admin/coupons/import": {
             "post": {
-                "description": "Returns applicable coupons based on order/cart",
+                "description": "Creates coupons from a CSV file (header row with the coupon json field names, lists separated by |) or NDJSON (one coupon per line). Server managed fields like id, redemptions_used and created_at are skipped. Every row is validated and the outcome of each row is reported, the valid rows are saved even if other rows fail. Nothing is saved on a dry run.",
                 "consumes": [
-                    "application/json"
+                    "text/csv",
+                    "application/x-ndjson"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Public"
+                    "Admin"
                 ],
-                "summary": "Get applicable coupons",
+                "summary": "Import coupons",
                 "parameters": [
                     {
-                        "description": "Order info",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.ValidateCouponRequest"
-                        }
+                        "type": "boolean",
+                        "description": "Validate and report without saving",
+                        "name": "dry_run",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "OK"
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.CouponImportReport"
+                        }
                     },
                     "400": {
                         "description": "Bad Request"
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
                     }
                 }
             }
         },
-        "/v1/public/coupons/validate": {
+        "/v1/admin/coupons/usages/reverse": {
             "post": {
-                "description": "Validates a coupon code against a cart and returns the discount",
+                "description": "Reverses the coupon used for a cancelled or refunded order so that the use is given back to the user, the reversal is recorded in the history. Partial refunds are rejected for coupons with a discount budget",
                 "consumes": [
                     "application/json"
                 ],
@@ -99,17 +332,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Coupons"
+                    "Admin"
                 ],
-                "summary": "Validate a coupon",
+                "summary": "Reverse a coupon redemption",
                 "parameters": [
                     {
-                        "description": "Coupon validation request",
+                        "description": "Reversal request",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.ValidateCouponRequest"
+                            "$ref": "#/definitions/models.ReverseCouponUsageRequest"
                         }
                     }
                 ],
@@ -117,101 +350,1649 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.ValidationResult"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.CouponUsageReversal"
+                            }
                         }
                     },
                     "400": {
                         "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "models.CartItem": {
-            "type": "object",
-            "properties": {
-                "category": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "string"
-                }
-            }
         },
-        "models.Coupon": {
-            "type": "object",
-            "properties": {
-                "applicable_categories": {
-                    "type": "array",
-                    "items": {
-                        "type": "string"
+        "/v1/admin/coupons/{id}": {
+            "get": {
+                "description": "Returns the coupon along with its applicable medicines, categories and charges",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get a coupon",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Coupon ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
-                },
-                "applicable_medicine_ids": {
-                    "type": "array",
-                    "items": {
-                        "type": "string"
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Coupon"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
                     }
-                },
-                "coupon_code": {
-                    "type": "string"
-                },
-                "discount_type": {
-                    "type": "string"
-                },
-                "discount_value": {
-                    "type": "number"
-                },
-                "expiry_date": {
-                    "type": "string"
-                },
-                "id": {
-                    "type": "string"
-                },
-                "max_usage_per_user": {
-                    "type": "integer"
-                },
-                "min_order_value": {
-                    "type": "number"
-                },
-                "target": {
-                    "type": "string"
-                },
-                "terms_and_conditions": {
-                    "type": "string"
-                },
-                "usage_type": {
-                    "type": "string"
-                },
-                "valid_from": {
-                    "type": "string"
-                },
-                "valid_to": {
-                    "type": "string"
                 }
-            }
-        },
-        "models.DiscountBreakdown": {
-            "type": "object",
-            "properties": {
-                "charges_discount": {
-                    "type": "number"
-                },
-                "items_discount": {
-                    "type": "number"
-                }
-            }
-        },
-        "models.ValidateCouponRequest": {
-            "type": "object",
-            "properties": {
+            },
+            "put": {
+                "description": "Replaces all the coupon details including the applicable medicines, categories and charges. The status can only be changed through the status endpoint, a different status is rejected with 422",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Replace a coupon",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Coupon ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Coupon Payload",
+                        "name": "coupon",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Coupon"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Coupon"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/RequestErr"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a coupon which has never been used",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Delete a coupon",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Coupon ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/GenericResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "patch": {
+                "description": "Updates only the given coupon details, a given list of applicable medicines, categories or charges replaces the existing one. The status can only be changed through the status endpoint, a different status is rejected with 422",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Update a coupon",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Coupon ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Coupon fields to update",
+                        "name": "coupon",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Coupon"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Coupon"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/RequestErr"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/v1/admin/coupons/{id}/status": {
+            "post": {
+                "description": "Moves the coupon to draft, active, paused or archived and records who changed it. The activate and deactivate actions move the coupon to active and paused respectively. Only active coupons can be validated or listed as applicable.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Change the status of a coupon",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Coupon ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Status change",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CouponStatusRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.CouponStatusChange"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/RequestErr"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/v1/admin/coupons/{id}/status-history": {
+            "get": {
+                "description": "Returns the status changes of the coupon along with who changed it, latest first. The oldest change has an empty from_status and records the status the coupon was created with",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get the status history of a coupon",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Coupon ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.CouponStatusChange"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/v1/admin/coupons/{id}/users/{list}": {
+            "get": {
+                "description": "Streams the user ids on the allowlist or denylist of the coupon as CSV",
+                "produces": [
+                    "text/csv"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Export a coupon user list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Coupon ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "allow or deny",
+                        "name": "list",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    }
+                }
+            },
+            "post": {
+                "description": "Adds the uploaded user ids to the allowlist or denylist of the coupon. The body has one user id per line, only the first column of a CSV is read and a user_id header is skipped. A coupon with an allowlist is private to the allowed users and segments, a denied user never gets the coupon. With replace the list is cleared first.",
+                "consumes": [
+                    "text/csv",
+                    "text/plain"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Upload a coupon user list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Coupon ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "allow or deny",
+                        "name": "list",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Replace the list instead of adding to it",
+                        "name": "replace",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.CouponUserListReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Removes every user from the allowlist or denylist of the coupon, a coupon left without an allowlist is public again",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Clear a coupon user list",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Coupon ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "allow or deny",
+                        "name": "list",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/GenericResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/v1/admin/users/{id}/context": {
+            "get": {
+                "description": "Returns the stored order count, signup date and segments of the user used by the coupon rules",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Get the context of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserContext"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            },
+            "put": {
+                "description": "Creates or replaces the order count, signup date and segments of the user, called by the user and order services whenever they change",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Save the context of a user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "User context",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UserContext"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.UserContext"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/RequestErr"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/v1/public/coupons/applicable": {
+            "post": {
+                "description": "Returns the coupons the user can apply on the cart sorted by savings with the best one flagged, along with the coupons unlocked by adding more to the order. Every coupon is checked with the same rules as the validate endpoint.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Public"
+                ],
+                "summary": "Get applicable coupons",
+                "parameters": [
+                    {
+                        "description": "Order info",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidateCouponRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ApplicableCoupons"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/v1/public/coupons/commit": {
+            "post": {
+                "description": "Marks the coupon reserved for the order as used once the order is placed, the user must be the one the coupon was reserved for",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Coupons"
+                ],
+                "summary": "Commit a coupon reservation",
+                "parameters": [
+                    {
+                        "description": "Order of the reservation",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CouponOrderRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/GenericResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/v1/public/coupons/release": {
+            "post": {
+                "description": "Releases the coupon reserved for the order on payment failure or cancellation before placement, the user must be the one the coupon was reserved for",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Coupons"
+                ],
+                "summary": "Release a coupon reservation",
+                "parameters": [
+                    {
+                        "description": "Order of the reservation",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CouponOrderRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/GenericResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/v1/public/coupons/reserve": {
+            "post": {
+                "description": "Validates the coupon at the server time and holds its usage for the order till the TTL expires, the reservation must be committed on order placement or released on payment failure. The timestamp of the request is ignored.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Coupons"
+                ],
+                "summary": "Reserve a coupon for an order",
+                "parameters": [
+                    {
+                        "description": "Coupon reservation request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ReserveCouponRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.CouponReservation"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    },
+                    "409": {
+                        "description": "Conflict"
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        },
+        "/v1/public/coupons/validate": {
+            "post": {
+                "description": "Validates a coupon code against a cart and returns the discount without using the coupon",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Coupons"
+                ],
+                "summary": "Validate a coupon",
+                "parameters": [
+                    {
+                        "description": "Coupon validation request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidateCouponRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ValidationResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    }
+                }
+            }
+        },
+        "/v1/public/coupons/validate/combined": {
+            "post": {
+                "description": "Validates the coupon codes against the same cart and combines the valid ones. Coupons are tried by highest discount first and then by code, a coupon which is not stackable applies alone and at most one coupon of an exclusivity group applies. Returns the discount of every coupon and the total discount.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Coupons"
+                ],
+                "summary": "Validate several coupons together",
+                "parameters": [
+                    {
+                        "description": "Combined validation request",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.CombinedValidationRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.CombinedValidationResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request"
+                    },
+                    "500": {
+                        "description": "Internal Server Error"
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "GenericResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "RequestErr": {
+            "type": "object",
+            "properties": {
+                "developerInfo": {
+                    "description": "DeveloperInfo will contain additional developer info related with error\nExample: Invalid email format",
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Err contains the error or exception message\nExample: validation on email failed with error invalid email format",
+                    "type": "string"
+                },
+                "fields": {
+                    "description": "Fields will contain the validation error message for each invalid field\nExample: {\"discount_value\": \"must be greater than 0\"}",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "description": "ID for the request\nExample: 8YeCqPXmM",
+                    "type": "string"
+                },
+                "isClientError": {
+                    "description": "IsClientError will be false if some internal server error occurred",
+                    "type": "boolean"
+                },
+                "messageToUser": {
+                    "description": "MessageToUser will contain error message\nExample: Invalid Email",
+                    "type": "string"
+                },
+                "statusCode": {
+                    "description": "StatusCode will contain the status code for the error\nExample: 500",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.AlmostApplicableCoupon": {
+            "type": "object",
+            "properties": {
+                "coupon_code": {
+                    "type": "string"
+                },
+                "discount_value": {
+                    "type": "number"
+                },
+                "max_discount_amount": {
+                    "type": "number"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "shortfall": {
+                    "description": "Shortfall is the amount to add to the order to unlock the coupon",
+                    "type": "number"
+                }
+            }
+        },
+        "models.ApplicableCoupon": {
+            "type": "object",
+            "properties": {
+                "coupon_code": {
+                    "type": "string"
+                },
+                "discount": {
+                    "description": "Discount is the discount of the coupon for the given cart",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.DiscountBreakdown"
+                        }
+                    ]
+                },
+                "discount_value": {
+                    "type": "number"
+                },
+                "is_best": {
+                    "description": "IsBest is set for the coupon giving the highest savings",
+                    "type": "boolean"
+                },
+                "max_discount_amount": {
+                    "description": "MaxDiscountAmount is the most the coupon can save, zero means no cap",
+                    "type": "number"
+                },
+                "next_tier": {
+                    "description": "NextTier is the next slab of a tiered coupon, left out at the highest slab",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.NextDiscountTier"
+                        }
+                    ]
+                },
+                "savings": {
+                    "description": "Savings is the total discount of the coupon for the given cart",
+                    "type": "number"
+                }
+            }
+        },
+        "models.ApplicableCoupons": {
+            "type": "object",
+            "properties": {
+                "almost_applicable_coupons": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.AlmostApplicableCoupon"
+                    }
+                },
+                "applicable_coupons": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ApplicableCoupon"
+                    }
+                }
+            }
+        },
+        "models.CartItem": {
+            "type": "object",
+            "properties": {
+                "category": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "price": {
+                    "type": "number"
+                },
+                "quantity": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.Charge": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "type": {
+                    "$ref": "#/definitions/models.ChargeType"
+                }
+            }
+        },
+        "models.ChargeType": {
+            "type": "string",
+            "enum": [
+                "delivery",
+                "packaging",
+                "convenience",
+                "platform"
+            ],
+            "x-enum-varnames": [
+                "ChargeTypeDelivery",
+                "ChargeTypePackaging",
+                "ChargeTypeConvenience",
+                "ChargeTypePlatform"
+            ]
+        },
+        "models.CombinedCouponResult": {
+            "type": "object",
+            "properties": {
+                "applied": {
+                    "type": "boolean"
+                },
+                "coupon_code": {
+                    "type": "string"
+                },
+                "discount": {
+                    "$ref": "#/definitions/models.DiscountBreakdown"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.CombinedValidationRequest": {
+            "type": "object",
+            "properties": {
+                "cart_items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CartItem"
+                    }
+                },
+                "charges": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Charge"
+                    }
+                },
+                "coupon_code": {
+                    "type": "string"
+                },
+                "coupon_codes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "order_total": {
+                    "type": "number"
+                },
+                "timestamp": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.CombinedValidationResult": {
+            "type": "object",
+            "properties": {
+                "coupons": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CombinedCouponResult"
+                    }
+                },
+                "discount": {
+                    "$ref": "#/definitions/models.DiscountBreakdown"
+                },
+                "is_valid": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.Coupon": {
+            "type": "object",
+            "required": [
+                "allowed_segments",
+                "applicable_categories",
+                "applicable_medicine_ids",
+                "coupon_code",
+                "denied_segments",
+                "discount_type",
+                "expiry_date",
+                "target",
+                "usage_type"
+            ],
+            "properties": {
+                "allowed_segments": {
+                    "type": "array",
+                    "uniqueItems": true,
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "applicable_categories": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "applicable_charges": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ChargeType"
+                    }
+                },
+                "applicable_medicine_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "buy_quantity": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "coupon_code": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "denied_segments": {
+                    "type": "array",
+                    "uniqueItems": true,
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "discount_budget": {
+                    "type": "number",
+                    "minimum": 0
+                },
+                "discount_tiers": {
+                    "type": "array",
+                    "uniqueItems": true,
+                    "items": {
+                        "$ref": "#/definitions/models.DiscountTier"
+                    }
+                },
+                "discount_type": {
+                    "type": "string",
+                    "enum": [
+                        "percentage",
+                        "fixed",
+                        "buy_x_get_y",
+                        "tiered"
+                    ]
+                },
+                "discount_used": {
+                    "type": "number"
+                },
+                "discount_value": {
+                    "type": "number",
+                    "minimum": 0
+                },
+                "eligibility_rule": {
+                    "type": "string"
+                },
+                "exclusivity_group": {
+                    "type": "string"
+                },
+                "expiry_date": {
+                    "type": "string"
+                },
+                "first_order_only": {
+                    "type": "boolean"
+                },
+                "get_quantity": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "has_allowed_users": {
+                    "description": "HasAllowedUsers and HasDeniedUsers are set once user lists are uploaded through the coupon user list endpoints",
+                    "type": "boolean"
+                },
+                "has_denied_users": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "max_discount_amount": {
+                    "type": "number",
+                    "minimum": 0
+                },
+                "max_total_redemptions": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "max_usage_per_user": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "min_order_value": {
+                    "type": "number",
+                    "minimum": 0
+                },
+                "redemptions_used": {
+                    "description": "RedemptionsUsed and DiscountUsed count the committed and reserved usages, they are maintained by the redemptions",
+                    "type": "integer"
+                },
+                "remaining_budget": {
+                    "type": "number"
+                },
+                "remaining_redemptions": {
+                    "description": "RemainingRedemptions and RemainingBudget are left out when the coupon has no such cap",
+                    "type": "integer"
+                },
+                "reward_medicine_id": {
+                    "type": "string"
+                },
+                "signup_within_days": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "stackable": {
+                    "type": "boolean"
+                },
+                "status": {
+                    "description": "Status can only be changed through the status endpoints once the coupon is created",
+                    "type": "string",
+                    "enum": [
+                        "draft",
+                        "active",
+                        "paused",
+                        "archived"
+                    ]
+                },
+                "target": {
+                    "type": "string",
+                    "enum": [
+                        "inventory",
+                        "charges"
+                    ]
+                },
+                "terms_and_conditions": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "usage_type": {
+                    "type": "string",
+                    "enum": [
+                        "one_time",
+                        "multi_use",
+                        "time_based"
+                    ]
+                },
+                "valid_from": {
+                    "type": "string"
+                },
+                "valid_to": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.CouponCampaign": {
+            "type": "object",
+            "properties": {
+                "code_count": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.CouponImportReport": {
+            "type": "object",
+            "properties": {
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "rows": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CouponImportRow"
+                    }
+                },
+                "succeeded": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.CouponImportRow": {
+            "type": "object",
+            "properties": {
+                "coupon_code": {
+                    "type": "string"
+                },
+                "coupon_id": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "fields": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "row": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.CouponList": {
+            "type": "object",
+            "properties": {
+                "coupons": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Coupon"
+                    }
+                },
+                "limit": {
+                    "type": "integer"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.CouponOrderRequest": {
+            "type": "object",
+            "properties": {
+                "order_id": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "UserID must be the user the coupon was reserved for",
+                    "type": "string"
+                }
+            }
+        },
+        "models.CouponReservation": {
+            "type": "object",
+            "properties": {
+                "discount": {
+                    "$ref": "#/definitions/models.DiscountBreakdown"
+                },
+                "usage": {
+                    "$ref": "#/definitions/models.CouponUsage"
+                }
+            }
+        },
+        "models.CouponStatusChange": {
+            "type": "object",
+            "properties": {
+                "changed_at": {
+                    "type": "string"
+                },
+                "changed_by": {
+                    "type": "string"
+                },
+                "coupon_id": {
+                    "type": "string"
+                },
+                "from_status": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "to_status": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.CouponStatusRequest": {
+            "type": "object",
+            "required": [
+                "changed_by",
+                "status"
+            ],
+            "properties": {
+                "changed_by": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "draft",
+                        "active",
+                        "paused",
+                        "archived"
+                    ]
+                }
+            }
+        },
+        "models.CouponUsage": {
+            "type": "object",
+            "properties": {
+                "coupon_id": {
+                    "type": "string"
+                },
+                "discount_amount": {
+                    "type": "number"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "order_id": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "used_at": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.CouponUsageReversal": {
+            "type": "object",
+            "properties": {
+                "coupon_id": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "order_id": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "refund_type": {
+                    "type": "string"
+                },
+                "refunded_amount": {
+                    "type": "number"
+                },
+                "reversed_by": {
+                    "type": "string"
+                },
+                "usage_id": {
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.CouponUserListReport": {
+            "type": "object",
+            "properties": {
+                "added": {
+                    "type": "integer"
+                },
+                "coupon_id": {
+                    "type": "string"
+                },
+                "list": {
+                    "type": "string"
+                },
+                "received": {
+                    "type": "integer"
+                },
+                "replaced": {
+                    "type": "boolean"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.CreateCampaignRequest": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "alphabet": {
+                    "description": "Alphabet contains the characters used to generate the codes, ambiguous characters like 0/O and 1/I are left out by default",
+                    "type": "string",
+                    "minLength": 10
+                },
+                "code_length": {
+                    "description": "CodeLength is the number of generated characters after the prefix, 8 by default",
+                    "type": "integer",
+                    "maximum": 32,
+                    "minimum": 6
+                },
+                "count": {
+                    "type": "integer",
+                    "maximum": 100000
+                },
+                "coupon": {
+                    "description": "Coupon contains the rules shared by all the codes of the campaign, its coupon_code is ignored and its\nmax_total_redemptions is 1 by default",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.Coupon"
+                        }
+                    ]
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "Prefix is added before every generated code",
+                    "type": "string"
+                }
+            }
+        },
+        "models.DiscountBreakdown": {
+            "type": "object",
+            "properties": {
+                "charge_discounts": {
+                    "description": "ChargeDiscounts contains the discount given on each charge type",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number"
+                    }
+                },
+                "charges_discount": {
+                    "type": "number"
+                },
+                "items_discount": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.DiscountTier": {
+            "type": "object",
+            "required": [
+                "discount_type"
+            ],
+            "properties": {
+                "discount_type": {
+                    "type": "string",
+                    "enum": [
+                        "percentage",
+                        "fixed"
+                    ]
+                },
+                "discount_value": {
+                    "type": "number"
+                },
+                "min_subtotal": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.NextDiscountTier": {
+            "type": "object",
+            "required": [
+                "discount_type"
+            ],
+            "properties": {
+                "discount_type": {
+                    "type": "string",
+                    "enum": [
+                        "percentage",
+                        "fixed"
+                    ]
+                },
+                "discount_value": {
+                    "type": "number"
+                },
+                "min_subtotal": {
+                    "type": "number"
+                },
+                "shortfall": {
+                    "type": "number"
+                }
+            }
+        },
+        "models.ReserveCouponRequest": {
+            "type": "object",
+            "properties": {
+                "cart_items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.CartItem"
+                    }
+                },
+                "charges": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Charge"
+                    }
+                },
+                "coupon_code": {
+                    "type": "string"
+                },
+                "order_id": {
+                    "type": "string"
+                },
+                "order_total": {
+                    "type": "number"
+                },
+                "timestamp": {
+                    "type": "string"
+                },
+                "ttl_seconds": {
+                    "description": "TTLSeconds is the time for which the usage stays reserved for the order",
+                    "type": "integer"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ReverseCouponUsageRequest": {
+            "type": "object",
+            "properties": {
+                "order_id": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "refund_type": {
+                    "description": "RefundType is either full or partial, defaults to full",
+                    "type": "string"
+                },
+                "refunded_amount": {
+                    "type": "number"
+                },
+                "reversed_by": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.UserContext": {
+            "type": "object",
+            "required": [
+                "segments"
+            ],
+            "properties": {
+                "order_count": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "segments": {
+                    "type": "array",
+                    "uniqueItems": true,
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "signup_date": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ValidateCouponRequest": {
+            "type": "object",
+            "properties": {
                 "cart_items": {
                     "type": "array",
                     "items": {
                         "$ref": "#/definitions/models.CartItem"
                     }
                 },
+                "charges": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Charge"
+                    }
+                },
                 "coupon_code": {
                     "type": "string"
                 },
@@ -221,7 +2002,7 @@ const docTemplate = `{
                 "timestamp": {
                     "type": "string"
                 },
-                "user_id db:": {
+                "user_id": {
                     "type": "string"
                 }
             }
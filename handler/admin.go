@@ -0,0 +1,363 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"farmako-coupon-service/cache"
+	"farmako-coupon-service/database"
+	"farmako-coupon-service/dbhelper"
+	"farmako-coupon-service/models"
+	"farmako-coupon-service/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// GetCoupon godoc
+// @Summary            Get a coupon
+// @Description        Returns the coupon along with its applicable medicines, categories and charges
+// @Tags               Admin
+// @Produce            json
+// @Param              id     path    string   true   "Coupon ID"
+// @Success            200    {object}  models.Coupon
+// @Failure            404
+// @Failure            500
+// @Router             /v1/admin/coupons/{id} [get]
+func GetCoupon(w http.ResponseWriter, r *http.Request) {
+	coupon, err := dbhelper.GetCouponByID(database.FCS, chi.URLParam(r, "id"))
+	if err != nil {
+		respondCouponError(w, err, "Failed to fetch coupon")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, coupon)
+}
+
+// ListCoupons godoc
+// @Summary            List coupons
+// @Description        Returns a page of the coupons matching the filters, newest first
+// @Tags               Admin
+// @Produce            json
+// @Param              code             query   string   false  "Coupon code prefix"
+// @Param              status           query   string   false  "Status (draft, active, paused, archived)"
+// @Param              target           query   string   false  "Target (inventory, charges)"
+// @Param              discount_type    query   string   false  "Discount type"
+// @Param              usage_type       query   string   false  "Usage type"
+// @Param              expires_after    query   string   false  "Expiry date lower bound (RFC3339)"
+// @Param              expires_before   query   string   false  "Expiry date upper bound (RFC3339)"
+// @Param              active_at        query   string   false  "Coupons usable at the time (RFC3339)"
+// @Param              limit            query   int      false  "Page size, 20 by default and 100 at most"
+// @Param              offset           query   int      false  "Page offset"
+// @Success            200    {object}  models.CouponList
+// @Failure            400
+// @Failure            500
+// @Router             /v1/admin/coupons [get]
+func ListCoupons(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseCouponFilter(r.URL.Query())
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid filters")
+		return
+	}
+
+	coupons, err := dbhelper.ListCoupons(database.FCS, filter)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, err, "Failed to list coupons")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, coupons)
+}
+
+// ReplaceCoupon godoc
+// @Summary            Replace a coupon
+// @Description        Replaces all the coupon details including the applicable medicines, categories and charges. The status can only be changed through the status endpoint, a different status is rejected with 422
+// @Tags               Admin
+// @Accept             json
+// @Produce            json
+// @Param              id       path    string          true   "Coupon ID"
+// @Param              coupon   body    models.Coupon   true   "Coupon Payload"
+// @Success            200    {object}  models.Coupon
+// @Failure            400
+// @Failure            404
+// @Failure            409
+// @Failure            422    {object}  utils.RequestErr
+// @Failure            500
+// @Router             /v1/admin/coupons/{id} [put]
+func ReplaceCoupon(w http.ResponseWriter, r *http.Request) {
+	var replacement models.Coupon
+	if err := utils.ParseBody(r.Body, &replacement); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	saveCoupon(w, chi.URLParam(r, "id"), func(coupon *models.Coupon) error {
+		*coupon = replacement
+		return nil
+	})
+}
+
+// UpdateCoupon godoc
+// @Summary            Update a coupon
+// @Description        Updates only the given coupon details, a given list of applicable medicines, categories or charges replaces the existing one. The status can only be changed through the status endpoint, a different status is rejected with 422
+// @Tags               Admin
+// @Accept             json
+// @Produce            json
+// @Param              id       path    string          true   "Coupon ID"
+// @Param              coupon   body    models.Coupon   true   "Coupon fields to update"
+// @Success            200    {object}  models.Coupon
+// @Failure            400
+// @Failure            404
+// @Failure            409
+// @Failure            422    {object}  utils.RequestErr
+// @Failure            500
+// @Router             /v1/admin/coupons/{id} [patch]
+func UpdateCoupon(w http.ResponseWriter, r *http.Request) {
+	// the body is read up front so the coupon is not kept locked while a slow client sends it
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+
+	// decoding over the existing coupon only overwrites the fields present in the body
+	saveCoupon(w, chi.URLParam(r, "id"), func(coupon *models.Coupon) error {
+		return utils.ParseBody(bytes.NewReader(body), coupon)
+	})
+}
+
+// couponRequestError is an invalid coupon update found while saving the coupon, it is responded with its status code
+type couponRequestError struct {
+	statusCode    int
+	messageToUser string
+	err           error
+}
+
+func (e *couponRequestError) Error() string {
+	return e.err.Error()
+}
+
+// saveCoupon locks the coupon, applies the changes of the request to it and updates the coupon along with its
+// relations in the same transaction, so concurrent updates of the coupon can not overwrite each other.
+// It responds with the saved coupon.
+func saveCoupon(w http.ResponseWriter, couponID string, applyChanges func(coupon *models.Coupon) error) {
+	var saved *models.Coupon
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		coupon, err := dbhelper.GetCouponByIDForUpdate(tx, couponID)
+		if err != nil {
+			return errors.Wrap(err, "saveCoupon: failed to fetch coupon")
+		}
+
+		storedStatus := coupon.Status
+		if err := applyChanges(coupon); err != nil {
+			return &couponRequestError{statusCode: http.StatusBadRequest, messageToUser: "Invalid request body", err: err}
+		}
+		// the status only changes through the status endpoint, which checks the move and records it
+		if coupon.Status == "" {
+			coupon.Status = storedStatus
+		}
+		if coupon.Status != storedStatus {
+			return &couponRequestError{
+				statusCode:    http.StatusUnprocessableEntity,
+				messageToUser: "Change the status through POST /v1/admin/coupons/{id}/status",
+				err:           fmt.Errorf("status can not be changed from %s to %s by an update", storedStatus, coupon.Status),
+			}
+		}
+		coupon.ID = couponID
+		coupon.CouponCode = utils.NormalizeCouponCode(coupon.CouponCode)
+		if err := utils.ValidateStruct(coupon); err != nil {
+			return &couponRequestError{statusCode: http.StatusUnprocessableEntity, messageToUser: "Invalid coupon details", err: err}
+		}
+
+		if err := dbhelper.UpdateCoupon(tx, coupon); err != nil {
+			return errors.Wrap(err, "saveCoupon: failed to update coupon")
+		}
+		if err := dbhelper.ReplaceCouponRelations(tx, coupon); err != nil {
+			return errors.Wrap(err, "saveCoupon: failed to replace coupon relations")
+		}
+
+		saved, err = dbhelper.GetCouponByID(tx, coupon.ID)
+		return err
+	})
+	var requestErr *couponRequestError
+	if errors.As(txErr, &requestErr) {
+		utils.RespondError(w, requestErr.statusCode, requestErr.err, requestErr.messageToUser)
+		return
+	}
+	if txErr != nil {
+		respondCouponError(w, txErr, "Failed to update coupon")
+		return
+	}
+
+	cache.CouponCache.Flush()
+	utils.RespondJSON(w, http.StatusOK, saved)
+}
+
+// DeleteCoupon godoc
+// @Summary            Delete a coupon
+// @Description        Deletes a coupon which has never been used
+// @Tags               Admin
+// @Produce            json
+// @Param              id     path    string   true   "Coupon ID"
+// @Success            200    {object}  utils.GenericResponse
+// @Failure            404
+// @Failure            409
+// @Failure            500
+// @Router             /v1/admin/coupons/{id} [delete]
+func DeleteCoupon(w http.ResponseWriter, r *http.Request) {
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return dbhelper.DeleteCoupon(tx, chi.URLParam(r, "id"))
+	})
+	if txErr != nil {
+		respondCouponError(w, txErr, "Failed to delete coupon")
+		return
+	}
+
+	cache.CouponCache.Flush()
+	utils.Response(w, "coupon deleted")
+}
+
+// respondCouponError responds with 404 for missing coupons, 409 for conflicts, 422 for values
+// rejected by the database and 500 otherwise
+func respondCouponError(w http.ResponseWriter, err error, messageToUser string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.RespondError(w, http.StatusNotFound, err, "Coupon not found")
+	case errors.Is(err, dbhelper.ErrCouponInUse):
+		utils.RespondError(w, http.StatusConflict, err, "Coupon has been used, it can not be deleted")
+	case dbhelper.IsDuplicateKeyError(err):
+		utils.RespondError(w, http.StatusConflict, err, "Coupon code already exists")
+	case dbhelper.IsCheckViolationError(err):
+		utils.RespondError(w, http.StatusUnprocessableEntity, err, "Invalid coupon details")
+	default:
+		utils.RespondError(w, http.StatusInternalServerError, err, messageToUser)
+	}
+}
+
+// parseCouponFilter reads the coupon filter from the query params
+func parseCouponFilter(query url.Values) (models.CouponFilter, error) {
+	filter := models.CouponFilter{
+		Code:         query.Get("code"),
+		Status:       query.Get("status"),
+		Target:       query.Get("target"),
+		DiscountType: query.Get("discount_type"),
+		UsageType:    query.Get("usage_type"),
+	}
+
+	var err error
+	if filter.ExpiresAfter, err = parseTimeParam(query, "expires_after"); err != nil {
+		return filter, err
+	}
+	if filter.ExpiresBefore, err = parseTimeParam(query, "expires_before"); err != nil {
+		return filter, err
+	}
+	if filter.ActiveAt, err = parseTimeParam(query, "active_at"); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = parseIntParam(query, "limit"); err != nil {
+		return filter, err
+	}
+	if filter.Offset, err = parseIntParam(query, "offset"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func parseTimeParam(query url.Values, key string) (*time.Time, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return &t, nil
+}
+
+func parseIntParam(query url.Values, key string) (int, error) {
+	value := query.Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return n, nil
+}
+
+// ChangeCouponStatus godoc
+// @Summary            Change the status of a coupon
+// @Description        Moves the coupon to draft, active, paused or archived and records who changed it. The activate and deactivate actions move the coupon to active and paused respectively. Only active coupons can be validated or listed as applicable.
+// @Tags               Admin
+// @Accept             json
+// @Produce            json
+// @Param              id        path    string                       true   "Coupon ID"
+// @Param              request   body    models.CouponStatusRequest   true   "Status change"
+// @Success            200    {object}  models.CouponStatusChange
+// @Failure            400
+// @Failure            404
+// @Failure            409
+// @Failure            422    {object}  utils.RequestErr
+// @Failure            500
+// @Router             /v1/admin/coupons/{id}/status [post]
+func ChangeCouponStatus(w http.ResponseWriter, r *http.Request) {
+	var req models.CouponStatusRequest
+	if err := utils.ParseBody(r.Body, &req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+
+	switch utils.Status(req.Status) {
+	case utils.Activate:
+		req.Status = models.CouponStatusActive
+	case utils.Deactivate:
+		req.Status = models.CouponStatusPaused
+	}
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.RespondError(w, http.StatusUnprocessableEntity, err, "Invalid status change, status must be draft, active, paused or archived and changed_by is required")
+		return
+	}
+
+	var change *models.CouponStatusChange
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		change, err = dbhelper.ChangeCouponStatus(tx, chi.URLParam(r, "id"), req)
+		return err
+	})
+	if txErr != nil {
+		if errors.Is(txErr, dbhelper.ErrInvalidStatusTransition) {
+			utils.RespondError(w, http.StatusConflict, txErr, "Coupon can not move to the requested status")
+			return
+		}
+		respondCouponError(w, txErr, "Failed to change coupon status")
+		return
+	}
+
+	// paused or archived coupons must stop showing up in the applicable coupons right away
+	cache.CouponCache.Flush()
+	utils.RespondJSON(w, http.StatusOK, change)
+}
+
+// GetCouponStatusHistory godoc
+// @Summary            Get the status history of a coupon
+// @Description        Returns the status changes of the coupon along with who changed it, latest first. The oldest change has an empty from_status and records the status the coupon was created with
+// @Tags               Admin
+// @Produce            json
+// @Param              id     path    string   true   "Coupon ID"
+// @Success            200    {array}   models.CouponStatusChange
+// @Failure            404
+// @Failure            500
+// @Router             /v1/admin/coupons/{id}/status-history [get]
+func GetCouponStatusHistory(w http.ResponseWriter, r *http.Request) {
+	history, err := dbhelper.GetCouponStatusHistory(database.FCS, chi.URLParam(r, "id"))
+	if err != nil {
+		respondCouponError(w, err, "Failed to fetch coupon status history")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, history)
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"encoding/csv"
+	"farmako-coupon-service/cache"
+	"farmako-coupon-service/database"
+	"farmako-coupon-service/dbhelper"
+	"farmako-coupon-service/models"
+	"farmako-coupon-service/utils"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// audienceBatchSize is the number of user ids inserted by a single statement of a user list upload
+const audienceBatchSize = 1000
+
+// UploadCouponUsers godoc
+// @Summary            Upload a coupon user list
+// @Description        Adds the uploaded user ids to the allowlist or denylist of the coupon. The body has one user id per line, only the first column of a CSV is read and a user_id header is skipped. A coupon with an allowlist is private to the allowed users and segments, a denied user never gets the coupon. With replace the list is cleared first.
+// @Tags               Admin
+// @Accept             text/csv
+// @Accept             text/plain
+// @Produce            json
+// @Param              id        path    string   true   "Coupon ID"
+// @Param              list      path    string   true   "allow or deny"
+// @Param              replace   query   bool     false  "Replace the list instead of adding to it"
+// @Success            200    {object}  models.CouponUserListReport
+// @Failure            400
+// @Failure            404
+// @Failure            415
+// @Failure            500
+// @Router             /v1/admin/coupons/{id}/users/{list} [post]
+func UploadCouponUsers(w http.ResponseWriter, r *http.Request) {
+	couponID, list, ok := parseCouponUserList(w, r)
+	if !ok {
+		return
+	}
+	replace, err := strconv.ParseBool(r.URL.Query().Get("replace"))
+	if err != nil && r.URL.Query().Get("replace") != "" {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid replace")
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "text/csv" && mediaType != "text/plain" {
+		utils.RespondError(w, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %q", mediaType), "Upload the user ids as text/csv or text/plain")
+		return
+	}
+
+	report := models.CouponUserListReport{CouponID: couponID, List: list, Replaced: replace}
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		if _, err := dbhelper.GetCouponByID(tx, couponID); err != nil {
+			return err
+		}
+		if replace {
+			if _, err := dbhelper.ClearCouponAudienceUsers(tx, couponID, list); err != nil {
+				return errors.Wrap(err, "UploadCouponUsers: failed to clear the user list")
+			}
+		}
+
+		err := readUserIDs(r.Body, func(batch []string) error {
+			report.Received += len(batch)
+			added, err := dbhelper.AddCouponAudienceUsers(tx, couponID, list, batch)
+			report.Added += added
+			return errors.Wrap(err, "UploadCouponUsers: failed to add the users")
+		})
+		if err != nil {
+			return err
+		}
+
+		report.Total, err = dbhelper.CountCouponAudienceUsers(tx, couponID, list)
+		return err
+	})
+	if txErr != nil {
+		var parseErr *csv.ParseError
+		if errors.As(txErr, &parseErr) {
+			utils.RespondError(w, http.StatusBadRequest, txErr, "Invalid user list file")
+			return
+		}
+		respondCouponError(w, txErr, "Failed to upload the user list")
+		return
+	}
+
+	cache.CouponCache.Flush()
+	utils.RespondJSON(w, http.StatusOK, report)
+}
+
+// ExportCouponUsers godoc
+// @Summary            Export a coupon user list
+// @Description        Streams the user ids on the allowlist or denylist of the coupon as CSV
+// @Tags               Admin
+// @Produce            text/csv
+// @Param              id     path    string   true   "Coupon ID"
+// @Param              list   path    string   true   "allow or deny"
+// @Success            200
+// @Failure            400
+// @Failure            404
+// @Router             /v1/admin/coupons/{id}/users/{list} [get]
+func ExportCouponUsers(w http.ResponseWriter, r *http.Request) {
+	couponID, list, ok := parseCouponUserList(w, r)
+	if !ok {
+		return
+	}
+	if _, err := dbhelper.GetCouponByID(database.FCS, couponID); err != nil {
+		respondCouponError(w, err, "Failed to fetch coupon")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=coupon-%s-%s.csv", couponID, list))
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"user_id"}); err != nil {
+		return
+	}
+	err := dbhelper.StreamCouponAudienceUsers(database.FCS, couponID, list, func(userID string) error {
+		return writer.Write([]string{userID})
+	})
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		// the status is already sent, the export can only be cut short
+		logrus.Errorf("failed to export the %s list of coupon %s: %+v", list, couponID, err)
+	}
+}
+
+// ClearCouponUsers godoc
+// @Summary            Clear a coupon user list
+// @Description        Removes every user from the allowlist or denylist of the coupon, a coupon left without an allowlist is public again
+// @Tags               Admin
+// @Produce            json
+// @Param              id     path    string   true   "Coupon ID"
+// @Param              list   path    string   true   "allow or deny"
+// @Success            200    {object}  utils.GenericResponse
+// @Failure            400
+// @Failure            404
+// @Failure            500
+// @Router             /v1/admin/coupons/{id}/users/{list} [delete]
+func ClearCouponUsers(w http.ResponseWriter, r *http.Request) {
+	couponID, list, ok := parseCouponUserList(w, r)
+	if !ok {
+		return
+	}
+	if _, err := dbhelper.GetCouponByID(database.FCS, couponID); err != nil {
+		respondCouponError(w, err, "Failed to fetch coupon")
+		return
+	}
+
+	removed, err := dbhelper.ClearCouponAudienceUsers(database.FCS, couponID, list)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, err, "Failed to clear the user list")
+		return
+	}
+
+	cache.CouponCache.Flush()
+	utils.Response(w, fmt.Sprintf("%d users removed from the %s list", removed, list))
+}
+
+// parseCouponUserList reads the coupon id and the list from the path, responding with 400 for an unknown list
+func parseCouponUserList(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	list := chi.URLParam(r, "list")
+	if !models.IsAudienceList(list) {
+		utils.RespondError(w, http.StatusBadRequest, fmt.Errorf("invalid list %q", list), "List must be allow or deny")
+		return "", "", false
+	}
+	return chi.URLParam(r, "id"), list, true
+}
+
+// readUserIDs reads the first column of every line and calls fn with batches of at most audienceBatchSize
+// user ids, blank lines and a user_id header are skipped
+func readUserIDs(body io.Reader, fn func(batch []string) error) error {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	batch := make([]string, 0, audienceBatchSize)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		userID := strings.TrimSpace(record[0])
+		if userID == "" || (line == 1 && userID == "user_id") {
+			continue
+		}
+		batch = append(batch, userID)
+		if len(batch) == audienceBatchSize {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return fn(batch)
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"farmako-coupon-service/cache"
+	"farmako-coupon-service/database"
+	"farmako-coupon-service/dbhelper"
+	"farmako-coupon-service/models"
+	"farmako-coupon-service/utils"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultCampaignCodeLength = 8
+
+// CreateCampaign godoc
+// @Summary            Create a coupon campaign
+// @Description        Creates a campaign generating the given number of unique codes, every code is a coupon sharing the rules of the campaign coupon. A code can be redeemed once in total unless the campaign coupon sets a bigger max_total_redemptions. The codes can be exported as CSV.
+// @Tags               Admin
+// @Accept             json
+// @Produce            json
+// @Param              request   body    models.CreateCampaignRequest   true   "Campaign Payload"
+// @Success            201    {object}  models.CouponCampaign
+// @Failure            400
+// @Failure            422    {object}  utils.RequestErr
+// @Failure            500
+// @Router             /v1/admin/campaigns [post]
+func CreateCampaign(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateCampaignRequest
+	if err := utils.ParseBody(r.Body, &req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+
+	req.Prefix = utils.NormalizeCouponCode(req.Prefix)
+	req.Alphabet = normalizeAlphabet(req.Alphabet)
+	if req.CodeLength == 0 {
+		req.CodeLength = defaultCampaignCodeLength
+	}
+	if req.Coupon.UsageType == "" {
+		req.Coupon.UsageType = models.UsageTypeOneTime
+	}
+	// every generated code is single use across all the users unless a bigger cap is given
+	if req.Coupon.MaxTotalRedemptions == 0 {
+		req.Coupon.MaxTotalRedemptions = 1
+	}
+	if req.Coupon.Status == "" {
+		req.Coupon.Status = models.CouponStatusActive
+	}
+
+	if len(req.Alphabet) < 10 {
+		utils.RespondError(w, http.StatusUnprocessableEntity, fmt.Errorf("alphabet has less than 10 distinct letters or digits"), "Alphabet must have at least 10 distinct letters or digits")
+		return
+	}
+
+	// the campaign coupon is validated with a sample code so that the generated codes follow the code format
+	sampleCode, err := utils.GenerateCouponCode(req.Prefix, req.Alphabet, req.CodeLength)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, err, "Failed to generate coupon code")
+		return
+	}
+	req.Coupon.CouponCode = sampleCode
+	if err := utils.ValidateStruct(req); err != nil {
+		utils.RespondError(w, http.StatusUnprocessableEntity, err, "Invalid campaign details")
+		return
+	}
+
+	var campaign *models.CouponCampaign
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		campaign, err = dbhelper.CreateCampaign(tx, req)
+		return err
+	})
+	if txErr != nil {
+		if errors.Is(txErr, dbhelper.ErrCodeSpaceExhausted) {
+			utils.RespondError(w, http.StatusUnprocessableEntity, txErr, "Could not generate enough unique codes")
+			return
+		}
+		respondCouponError(w, txErr, "Failed to create campaign")
+		return
+	}
+
+	cache.CouponCache.Flush()
+	utils.RespondJSON(w, http.StatusCreated, campaign)
+}
+
+// ExportCampaignCodes godoc
+// @Summary            Export the codes of a campaign
+// @Description        Streams the generated codes of the campaign as CSV
+// @Tags               Admin
+// @Produce            text/csv
+// @Param              id     path    string   true   "Campaign ID"
+// @Success            200
+// @Failure            404
+// @Failure            500
+// @Router             /v1/admin/campaigns/{id}/codes [get]
+func ExportCampaignCodes(w http.ResponseWriter, r *http.Request) {
+	campaign, err := dbhelper.GetCampaign(database.FCS, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondError(w, http.StatusNotFound, err, "Campaign not found")
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, err, "Failed to fetch campaign")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=campaign-%s.csv", campaign.ID))
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"coupon_code", "status", "expiry_date"}); err != nil {
+		return
+	}
+	err = dbhelper.StreamCampaignCodes(database.FCS, campaign.ID, func(code models.CampaignCode) error {
+		return writer.Write([]string{code.CouponCode, code.Status, code.ExpiryDate.Format(time.RFC3339)})
+	})
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		// the status is already sent, the export can only be cut short
+		logrus.Errorf("failed to export codes of campaign %s: %+v", campaign.ID, err)
+	}
+}
+
+// normalizeAlphabet converts the alphabet to uppercase and removes the repeated characters,
+// DefaultCodeAlphabet is used for an empty alphabet
+func normalizeAlphabet(alphabet string) string {
+	if alphabet == "" {
+		return utils.DefaultCodeAlphabet
+	}
+
+	var normalized strings.Builder
+	for _, char := range strings.ToUpper(alphabet) {
+		if (char >= 'A' && char <= 'Z' || char >= '0' && char <= '9') && !strings.ContainsRune(normalized.String(), char) {
+			normalized.WriteRune(char)
+		}
+	}
+	return normalized.String()
+}
@@ -8,14 +8,22 @@ import (
 	"farmako-coupon-service/utils"
 	"fmt"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	pcache "github.com/patrickmn/go-cache"
-	"github.com/pkg/errors"
 )
 
+const (
+	applicableCandidatesCacheKey = "applicable-coupon-candidates"
+	// maxCombinedCoupons is the most coupon codes validated together
+	maxCombinedCoupons = 5
+)
+
+func init() {
+	utils.RegisterStructValidation(models.CouponStructLevelValidation, models.Coupon{})
+}
+
 // CreateCoupon godoc
 //
 //	@Summary		Create a new coupon
@@ -26,6 +34,8 @@ import (
 //	@Produce		json
 //	@Success		201
 //	@Failure		400
+//	@Failure		409
+//	@Failure		422		{object}	utils.RequestErr
 //	@Failure		500
 //	@Router			/v1/admin/coupons   [post]
 func CreateCoupon(w http.ResponseWriter, r *http.Request) {
@@ -34,44 +44,38 @@ func CreateCoupon(w http.ResponseWriter, r *http.Request) {
 		utils.RespondError(w, http.StatusBadRequest, err, "Invalid request body")
 		return
 	}
+	coupon.CouponCode = utils.NormalizeCouponCode(coupon.CouponCode)
+	if err := utils.ValidateStruct(coupon); err != nil {
+		utils.RespondError(w, http.StatusUnprocessableEntity, err, "Invalid coupon details")
+		return
+	}
 
+	var couponID string
 	txErr := database.Tx(func(tx *sqlx.Tx) error {
-		// Insert core coupon
-		couponID, err := dbhelper.CreateCouponWithTx(tx, &coupon)
-		if err != nil {
-			return errors.Wrapf(err, "CreateCoupon: Failed to create coupon")
-		}
-		// Insert medicines
-		if err := dbhelper.InsertCouponApplicableMedicines(tx, couponID, coupon.ApplicableMedicineIDs); err != nil {
-			return errors.Wrapf(err, "CreateCoupon: Failed to insert applicable medicines")
-
-		}
-
-		// Insert categories
-		if err := dbhelper.InsertCouponApplicableCategories(tx, couponID, coupon.ApplicableCategories); err != nil {
-			return errors.Wrapf(err, "CreateCoupon: Failed to insert applicable categories")
-		}
-
-		utils.RespondJSON(w, http.StatusCreated, map[string]string{"coupon_id": couponID})
-		return nil
+		var err error
+		couponID, err = dbhelper.CreateCoupon(tx, &coupon)
+		return err
 	})
 	if txErr != nil {
-		utils.RespondError(w, http.StatusInternalServerError, txErr,
-			"CreateCoupon: failed to create entry for the coupon",
-		)
+		respondCouponError(w, txErr, "CreateCoupon: failed to create entry for the coupon")
 		return
 	}
+
+	// applicable coupons are cached, drop them so that the new coupon shows up
+	cache.CouponCache.Flush()
+	utils.RespondJSON(w, http.StatusCreated, map[string]string{"coupon_id": couponID})
 }
 
 // GetApplicableCoupons godoc
 // @Summary            Get applicable coupons
-// @Description        Returns applicable coupons based on order/cart
+// @Description        Returns the coupons the user can apply on the cart sorted by savings with the best one flagged, along with the coupons unlocked by adding more to the order. Every coupon is checked with the same rules as the validate endpoint.
 // @Tags               Public
 // @Accept             json
 // @Produce            json
 // @Param              request        body   models.ValidateCouponRequest   true "Order info"
-// @Success            200
+// @Success            200    {object}  models.ApplicableCoupons
 // @Failure            400
+// @Failure            500
 // @Router             /v1/public/coupons/applicable [post]
 func GetApplicableCoupons(w http.ResponseWriter, r *http.Request) {
 	var req models.ValidateCouponRequest
@@ -79,27 +83,37 @@ func GetApplicableCoupons(w http.ResponseWriter, r *http.Request) {
 		utils.RespondError(w, http.StatusBadRequest, err, "Invalid request body")
 		return
 	}
-
-	cacheKey := fmt.Sprintf("coupons-%v-%v", req.OrderTotal, req.Timestamp.Unix())
-	if cached, found := cache.CouponCache.Get(cacheKey); found {
-		coupons := cached.([]models.ApplicableCoupon)
-		utils.RespondJSON(w, http.StatusOK, map[string]interface{}{"applicable_coupons": coupons})
+	req.CouponCode = utils.NormalizeCouponCode(req.CouponCode)
+	if err := resolveUserContext(r, &req); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, err, "Failed to fetch user context")
 		return
 	}
 
-	coupons, err := dbhelper.FetchApplicableCoupons(database.FCS, req.CartItems, req.OrderTotal, req.Timestamp)
+	// the candidate coupons are cached while the cart and the usage of the user are evaluated on every request
+	var candidates []models.Coupon
+	if cached, found := cache.CouponCache.Get(applicableCandidatesCacheKey); found {
+		candidates = cached.([]models.Coupon)
+	} else {
+		var err error
+		candidates, err = dbhelper.FetchCandidateCoupons(database.FCS)
+		if err != nil {
+			utils.RespondError(w, http.StatusInternalServerError, err, "Failed to fetch applicable coupons")
+			return
+		}
+		cache.CouponCache.Set(applicableCandidatesCacheKey, candidates, pcache.DefaultExpiration)
+	}
+
+	coupons, err := dbhelper.FetchApplicableCoupons(database.FCS, candidates, req)
 	if err != nil {
 		utils.RespondError(w, http.StatusInternalServerError, err, "Failed to fetch applicable coupons")
 		return
 	}
-
-	cache.CouponCache.Set(cacheKey, coupons, pcache.DefaultExpiration)
-	utils.RespondJSON(w, http.StatusOK, map[string]interface{}{"applicable_coupons": coupons})
+	utils.RespondJSON(w, http.StatusOK, coupons)
 }
 
 // ValidateCoupon godoc
 // @Summary               Validate a coupon
-// @Description           Validates a coupon code against a cart and returns the discount
+// @Description           Validates a coupon code against a cart and returns the discount without using the coupon
 // @Tags                  Coupons
 // @Accept                json
 // @Produce               json
@@ -113,15 +127,17 @@ func ValidateCoupon(w http.ResponseWriter, r *http.Request) {
 		utils.RespondError(w, http.StatusBadRequest, err, "Invalid request body")
 		return
 	}
+	req.CouponCode = utils.NormalizeCouponCode(req.CouponCode)
 
-	// Channel to receive validation result
-	resultChan := make(chan *models.ValidationResult)
-	errorChan := make(chan error)
-	var wg sync.WaitGroup
-	wg.Add(1)
+	// Channel to receive validation result, buffered so that the goroutine never blocks after a timeout
+	resultChan := make(chan *models.ValidationResult, 1)
+	errorChan := make(chan error, 1)
 
 	go func() {
-		defer wg.Done()
+		if err := resolveUserContext(r, &req); err != nil {
+			errorChan <- err
+			return
+		}
 		result, err := dbhelper.ValidateCoupon(database.FCS, req)
 		if err != nil {
 			errorChan <- err
@@ -130,41 +146,10 @@ func ValidateCoupon(w http.ResponseWriter, r *http.Request) {
 		resultChan <- result
 	}()
 
-	// Close channels once goroutine finishes
-	go func() {
-		wg.Wait()
-		close(resultChan)
-		close(errorChan)
-	}()
-
 	// Wait for the result or error
 	select {
 	case res := <-resultChan:
-		// Start a transaction for the coupon usage check and insert
-		tx, err := database.FCS.Beginx()
-		if err != nil {
-			utils.RespondError(w, http.StatusInternalServerError, err, "Failed to start transaction")
-			return
-		}
-		defer tx.Rollback()
-
-		// 1. Check if the coupon is valid and hasn't been used already (record usage)
-		err = dbhelper.RecordCouponUsage(database.FCS, req.CouponCode, req.UserID)
-		if err != nil {
-			utils.RespondError(w, http.StatusConflict, err, "Failed to apply coupon")
-			return
-		}
-
-		// Commit the transaction if everything is fine
-		err = tx.Commit()
-		if err != nil {
-			utils.RespondError(w, http.StatusInternalServerError, err, "Failed to commit transaction")
-			return
-		}
-
-		// Respond with validation result
 		utils.RespondJSON(w, http.StatusOK, res)
-
 	case err := <-errorChan:
 		utils.RespondError(w, http.StatusInternalServerError, err, "Failed to validate coupon")
 	case <-time.After(2 * time.Second):
@@ -172,43 +157,47 @@ func ValidateCoupon(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func ValidateCoupon0(w http.ResponseWriter, r *http.Request) {
-	var req models.ValidateCouponRequest
+// ValidateCoupons godoc
+// @Summary               Validate several coupons together
+// @Description           Validates the coupon codes against the same cart and combines the valid ones. Coupons are tried by highest discount first and then by code, a coupon which is not stackable applies alone and at most one coupon of an exclusivity group applies. Returns the discount of every coupon and the total discount.
+// @Tags                  Coupons
+// @Accept                json
+// @Produce               json
+// @Param                 request    body      models.CombinedValidationRequest   true "Combined validation request"
+// @Success               200        {object}  models.CombinedValidationResult
+// @Failure               400
+// @Failure               500
+// @Router                /v1/public/coupons/validate/combined [post]
+func ValidateCoupons(w http.ResponseWriter, r *http.Request) {
+	var req models.CombinedValidationRequest
 	if err := utils.ParseBody(r.Body, &req); err != nil {
 		utils.RespondError(w, http.StatusBadRequest, err, "Invalid request body")
 		return
 	}
 
-	// Channel to receive validation result
-	resultChan := make(chan *models.ValidationResult)
-	errorChan := make(chan error)
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
-		result, err := dbhelper.ValidateCoupon(database.FCS, req)
-		if err != nil {
-			errorChan <- err
-			return
+	codes := make([]string, 0, len(req.CouponCodes))
+	seen := make(map[string]bool, len(req.CouponCodes))
+	for _, code := range req.CouponCodes {
+		code = utils.NormalizeCouponCode(code)
+		if code != "" && !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
 		}
-		resultChan <- result
-	}()
-
-	// Close channels once goroutine finishes
-	go func() {
-		wg.Wait()
-		close(resultChan)
-		close(errorChan)
-	}()
+	}
+	if len(codes) == 0 || len(codes) > maxCombinedCoupons {
+		utils.RespondError(w, http.StatusBadRequest, fmt.Errorf("%d coupon codes given", len(codes)), fmt.Sprintf("Give between 1 and %d coupon codes", maxCombinedCoupons))
+		return
+	}
+	req.CouponCodes = codes
+	if err := resolveUserContext(r, &req.ValidateCouponRequest); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, err, "Failed to fetch user context")
+		return
+	}
 
-	// Wait for the result or error
-	select {
-	case res := <-resultChan:
-		utils.RespondJSON(w, http.StatusOK, res)
-	case err := <-errorChan:
-		utils.RespondError(w, http.StatusInternalServerError, err, "Failed to validate coupon")
-	case <-time.After(2 * time.Second):
-		utils.RespondError(w, http.StatusRequestTimeout, fmt.Errorf("timeout"), "Validation took too long")
+	result, err := dbhelper.ValidateCoupons(database.FCS, req)
+	if err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, err, "Failed to validate coupons")
+		return
 	}
+	utils.RespondJSON(w, http.StatusOK, result)
 }
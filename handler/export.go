@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"farmako-coupon-service/database"
+	"farmako-coupon-service/dbhelper"
+	"farmako-coupon-service/models"
+	"farmako-coupon-service/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	exportFormatCSV    = "csv"
+	exportFormatNDJSON = "ndjson"
+)
+
+// couponExportHeader is the CSV header of the coupon export, the import reads the same header and skips the
+// server managed columns and the usage counts listed in couponReadOnlyColumns
+var couponExportHeader = []string{
+	"id", "coupon_code", "status", "target", "usage_type", "discount_type", "discount_value", "max_discount_amount",
+	"buy_quantity", "get_quantity", "reward_medicine_id", "discount_tiers", "eligibility_rule",
+	"first_order_only", "signup_within_days", "allowed_segments", "denied_segments",
+	"min_order_value", "max_usage_per_user", "max_total_redemptions", "discount_budget",
+	"stackable", "exclusivity_group", "expiry_date", "valid_from", "valid_to", "applicable_medicine_ids", "applicable_categories",
+	"applicable_charges", "terms_and_conditions", "created_at", "updated_at",
+	"redemption_count", "reserved_count", "reversed_count", "discount_given",
+}
+
+// ExportCoupons godoc
+// @Summary            Export coupons
+// @Description        Streams all the coupons matching the filters with their applicable medicines, categories, charges and usage counts as CSV or NDJSON. Lists are separated by | in the CSV. discount_given is the discount of the committed redemptions.
+// @Tags               Admin
+// @Produce            text/csv
+// @Produce            application/x-ndjson
+// @Param              format           query   string   false  "csv (default) or ndjson"
+// @Param              status           query   string   false  "Status (draft, active, paused, archived)"
+// @Param              target           query   string   false  "Target (inventory, charges)"
+// @Param              expires_after    query   string   false  "Expiry date lower bound (RFC3339)"
+// @Param              expires_before   query   string   false  "Expiry date upper bound (RFC3339)"
+// @Success            200
+// @Failure            400
+// @Router             /v1/admin/coupons/export [get]
+func ExportCoupons(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = exportFormatCSV
+	}
+	if format != exportFormatCSV && format != exportFormatNDJSON {
+		utils.RespondError(w, http.StatusBadRequest, fmt.Errorf("invalid format %q", format), "Format must be csv or ndjson")
+		return
+	}
+
+	filter := models.CouponFilter{Status: query.Get("status"), Target: query.Get("target")}
+	var err error
+	if filter.ExpiresAfter, err = parseTimeParam(query, "expires_after"); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid filters")
+		return
+	}
+	if filter.ExpiresBefore, err = parseTimeParam(query, "expires_before"); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid filters")
+		return
+	}
+
+	filename := fmt.Sprintf("coupons-%s.%s", time.Now().UTC().Format("20060102150405"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+
+	if format == exportFormatNDJSON {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+
+		encoder := json.NewEncoder(w)
+		err = dbhelper.StreamCoupons(database.FCS, filter, func(coupon models.CouponExport) error {
+			return encoder.Encode(coupon)
+		})
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+
+		writer := csv.NewWriter(w)
+		if err = writer.Write(couponExportHeader); err == nil {
+			err = dbhelper.StreamCoupons(database.FCS, filter, func(coupon models.CouponExport) error {
+				return writer.Write(couponExportRecord(coupon))
+			})
+		}
+		writer.Flush()
+		if err == nil {
+			err = writer.Error()
+		}
+	}
+	if err != nil {
+		// the status is already sent, the export can only be cut short
+		logrus.Errorf("failed to export coupons: %+v", err)
+	}
+}
+
+// couponExportRecord returns the CSV record of the coupon in the order of couponExportHeader
+func couponExportRecord(coupon models.CouponExport) []string {
+	charges := make([]string, 0, len(coupon.ApplicableCharges))
+	for _, charge := range coupon.ApplicableCharges {
+		charges = append(charges, string(charge))
+	}
+
+	return []string{
+		coupon.ID,
+		coupon.CouponCode,
+		coupon.Status,
+		coupon.Target,
+		coupon.UsageType,
+		coupon.DiscountType,
+		formatAmount(coupon.DiscountValue),
+		formatAmount(coupon.MaxDiscountAmount),
+		strconv.Itoa(coupon.BuyQuantity),
+		strconv.Itoa(coupon.GetQuantity),
+		coupon.RewardMedicineID,
+		models.FormatDiscountTiers(coupon.DiscountTiers),
+		coupon.EligibilityRule,
+		strconv.FormatBool(coupon.FirstOrderOnly),
+		strconv.Itoa(coupon.SignupWithinDays),
+		strings.Join(coupon.AllowedSegments, importListSeparator),
+		strings.Join(coupon.DeniedSegments, importListSeparator),
+		formatAmount(coupon.MinOrderValue),
+		strconv.Itoa(coupon.MaxUsagePerUser),
+		strconv.Itoa(coupon.MaxTotalRedemptions),
+		formatAmount(coupon.DiscountBudget),
+		strconv.FormatBool(coupon.Stackable),
+		coupon.ExclusivityGroup,
+		coupon.ExpiryDate.Format(time.RFC3339),
+		formatOptionalTime(coupon.ValidFrom),
+		formatOptionalTime(coupon.ValidTo),
+		strings.Join(coupon.ApplicableMedicineIDs, importListSeparator),
+		strings.Join(coupon.ApplicableCategories, importListSeparator),
+		strings.Join(charges, importListSeparator),
+		coupon.Terms,
+		coupon.CreatedAt.Format(time.RFC3339),
+		coupon.UpdatedAt.Format(time.RFC3339),
+		strconv.Itoa(coupon.RedemptionCount),
+		strconv.Itoa(coupon.ReservedCount),
+		strconv.Itoa(coupon.ReversedCount),
+		formatAmount(coupon.DiscountGiven),
+	}
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"farmako-coupon-service/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCouponExportImportRoundTrip(t *testing.T) {
+	validFrom := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	validTo := time.Date(2025, 6, 30, 23, 59, 59, 0, time.UTC)
+	remaining := 90
+	exported := models.CouponExport{
+		Coupon: models.Coupon{
+			ID:                    "4f1c7a52-3b0e-4c55-9d8e-2f6b1a0c9e11",
+			CouponCode:            "FEVER10",
+			ExpiryDate:            time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC),
+			UsageType:             models.UsageTypeTimeBased,
+			ApplicableMedicineIDs: []string{"med_123", "med_456"},
+			ApplicableCategories:  []string{"fever", "cold"},
+			ApplicableCharges:     []models.ChargeType{models.ChargeTypeDelivery},
+			MinOrderValue:         299.5,
+			ValidFrom:             &validFrom,
+			ValidTo:               &validTo,
+			Terms:                 "Valid once a week, with a comma",
+			DiscountType:          models.DiscountTypeTiered,
+			DiscountTiers: []models.DiscountTier{
+				{MinSubtotal: 500, DiscountType: models.DiscountTypePercentage, DiscountValue: 5},
+				{MinSubtotal: 1000, DiscountType: models.DiscountTypeFixed, DiscountValue: 120},
+			},
+			EligibilityRule:      `cart.total > 500 && "fever" in cart.categories`,
+			FirstOrderOnly:       true,
+			SignupWithinDays:     30,
+			AllowedSegments:      []string{"gold"},
+			DeniedSegments:       []string{"fraud"},
+			MaxDiscountAmount:    150,
+			MaxUsagePerUser:      2,
+			MaxTotalRedemptions:  100,
+			DiscountBudget:       5000,
+			Target:               models.TargetInventory,
+			Stackable:            true,
+			ExclusivityGroup:     "seasonal",
+			RedemptionsUsed:      10,
+			DiscountUsed:         750,
+			RemainingRedemptions: &remaining,
+			HasAllowedUsers:      true,
+			Status:               models.CouponStatusActive,
+			CreatedAt:            time.Date(2024, 12, 1, 10, 0, 0, 0, time.UTC),
+			UpdatedAt:            time.Date(2024, 12, 2, 10, 0, 0, 0, time.UTC),
+		},
+		RedemptionCount: 8,
+		ReservedCount:   2,
+		ReversedCount:   1,
+		DiscountGiven:   600,
+	}
+
+	var file bytes.Buffer
+	writer := csv.NewWriter(&file)
+	if err := writer.Write(couponExportHeader); err != nil {
+		t.Fatalf("failed to write the header: %v", err)
+	}
+	if err := writer.Write(couponExportRecord(exported)); err != nil {
+		t.Fatalf("failed to write the record: %v", err)
+	}
+	writer.Flush()
+
+	rows, err := parseCouponCSV(&file)
+	if err != nil {
+		t.Fatalf("parseCouponCSV of an export failed: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("parseCouponCSV returned %d rows, want 1", len(rows))
+	}
+	if rows[0].result.Error != "" {
+		t.Fatalf("parseCouponCSV rejected the exported row: %s", rows[0].result.Error)
+	}
+
+	want := exported.Coupon
+	clearReadOnlyFields(&want)
+	if !reflect.DeepEqual(rows[0].coupon, want) {
+		t.Errorf("imported coupon = %+v\nwant %+v", rows[0].coupon, want)
+	}
+}
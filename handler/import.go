@@ -0,0 +1,352 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"farmako-coupon-service/cache"
+	"farmako-coupon-service/database"
+	"farmako-coupon-service/dbhelper"
+	"farmako-coupon-service/models"
+	"farmako-coupon-service/utils"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	importBatchSize = 500
+	// importMaxLineSize is the longest NDJSON line accepted
+	importMaxLineSize = 1 << 20
+	// importListSeparator separates the values of the list columns in a CSV cell
+	importListSeparator = "|"
+)
+
+// errImportDryRun rolls back the import transaction of a dry run
+var errImportDryRun = errors.New("dry run")
+
+// couponReadOnlyColumns are the coupon fields managed by the server and the usage counts added by the export,
+// the import skips their cells so that an export can be imported again
+var couponReadOnlyColumns = map[string]bool{
+	"id":                    true,
+	"redemptions_used":      true,
+	"discount_used":         true,
+	"remaining_redemptions": true,
+	"remaining_budget":      true,
+	"has_allowed_users":     true,
+	"has_denied_users":      true,
+	"created_at":            true,
+	"updated_at":            true,
+	"redemption_count":      true,
+	"reserved_count":        true,
+	"reversed_count":        true,
+	"discount_given":        true,
+}
+
+// couponImportColumns maps the json name of every writable coupon field to its type, the CSV header uses the json names
+var couponImportColumns = func() map[string]reflect.Type {
+	columns := make(map[string]reflect.Type)
+	couponType := reflect.TypeOf(models.Coupon{})
+	for i := 0; i < couponType.NumField(); i++ {
+		field := couponType.Field(i)
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name != "" && name != "-" && !couponReadOnlyColumns[name] {
+			columns[name] = field.Type
+		}
+	}
+	return columns
+}()
+
+// importRow is a parsed row waiting to be imported
+type importRow struct {
+	coupon models.Coupon
+	result *models.CouponImportRow
+}
+
+// ImportCoupons godoc
+// @Summary            Import coupons
+// @Description        Creates coupons from a CSV file (header row with the coupon json field names, lists separated by |) or NDJSON (one coupon per line). Server managed fields like id, redemptions_used and created_at are skipped. Every row is validated and the outcome of each row is reported, the valid rows are saved even if other rows fail. Nothing is saved on a dry run.
+// @Tags               Admin
+// @Accept             text/csv
+// @Accept             application/x-ndjson
+// @Produce            json
+// @Param              dry_run   query   bool   false  "Validate and report without saving"
+// @Success            200    {object}  models.CouponImportReport
+// @Failure            400
+// @Failure            415
+// @Failure            500
+// @Router             /v1/admin/coupons/import [post]
+func ImportCoupons(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	if err != nil && r.URL.Query().Get("dry_run") != "" {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid dry_run")
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var rows []importRow
+	switch mediaType {
+	case "text/csv":
+		rows, err = parseCouponCSV(r.Body)
+	case "application/x-ndjson", "application/ndjson":
+		rows, err = parseCouponNDJSON(r.Body)
+	default:
+		utils.RespondError(w, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %q", mediaType), "Upload the coupons as text/csv or application/x-ndjson")
+		return
+	}
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid import file")
+		return
+	}
+
+	validateImportRows(rows)
+
+	valid := make([]importRow, 0, len(rows))
+	for _, row := range rows {
+		if row.result.Error == "" {
+			valid = append(valid, row)
+		}
+	}
+	for start := 0; start < len(valid); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(valid) {
+			end = len(valid)
+		}
+		importCouponBatch(valid[start:end], dryRun)
+	}
+
+	report := models.CouponImportReport{DryRun: dryRun, Total: len(rows), Rows: make([]models.CouponImportRow, 0, len(rows))}
+	for _, row := range rows {
+		if row.result.Error == "" {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+		report.Rows = append(report.Rows, *row.result)
+	}
+
+	if !dryRun && report.Succeeded > 0 {
+		cache.CouponCache.Flush()
+	}
+	utils.RespondJSON(w, http.StatusOK, report)
+}
+
+// validateImportRows validates every parsed row and rejects the codes repeated within the file
+func validateImportRows(rows []importRow) {
+	seen := make(map[string]int, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		if row.result.Error != "" {
+			continue
+		}
+
+		row.coupon.CouponCode = utils.NormalizeCouponCode(row.coupon.CouponCode)
+		row.result.CouponCode = row.coupon.CouponCode
+		if err := utils.ValidateStruct(row.coupon); err != nil {
+			row.result.Error = err.Error()
+			var fieldErr utils.FieldError
+			if errors.As(err, &fieldErr) {
+				row.result.Fields = fieldErr.Fields()
+			}
+			continue
+		}
+
+		if first, found := seen[row.coupon.CouponCode]; found {
+			row.result.Error = fmt.Sprintf("coupon code is repeated in row %d", first)
+			continue
+		}
+		seen[row.coupon.CouponCode] = row.result.Row
+	}
+}
+
+// importCouponBatch inserts the rows in a single transaction, a failed row does not stop the others.
+// The transaction is rolled back on a dry run so the database checks still run.
+func importCouponBatch(rows []importRow, dryRun bool) {
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		for _, row := range rows {
+			couponID, err := dbhelper.ImportCoupon(tx, &row.coupon)
+			if err != nil {
+				row.result.Error = importErrorMessage(err)
+				continue
+			}
+			row.result.CouponID = couponID
+		}
+		if dryRun {
+			return errImportDryRun
+		}
+		return nil
+	})
+	if txErr == nil || errors.Is(txErr, errImportDryRun) {
+		if dryRun {
+			for _, row := range rows {
+				row.result.CouponID = ""
+			}
+		}
+		return
+	}
+
+	// nothing of the batch is saved when the transaction itself fails
+	for _, row := range rows {
+		row.result.CouponID = ""
+		if row.result.Error == "" {
+			row.result.Error = txErr.Error()
+		}
+	}
+}
+
+// importErrorMessage returns the reason of a failed row as reported to the admin
+func importErrorMessage(err error) string {
+	switch {
+	case dbhelper.IsDuplicateKeyError(err):
+		return "coupon code already exists"
+	case dbhelper.IsCheckViolationError(err):
+		return "invalid coupon details"
+	default:
+		return err.Error()
+	}
+}
+
+// parseCouponNDJSON reads one coupon per line, blank lines are skipped
+func parseCouponNDJSON(body io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), importMaxLineSize)
+
+	var rows []importRow
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		row := importRow{result: &models.CouponImportRow{Row: len(rows) + 1}}
+		if err := json.Unmarshal([]byte(line), &row.coupon); err != nil {
+			row.result.Error = fmt.Sprintf("invalid json: %s", err)
+		}
+		clearReadOnlyFields(&row.coupon)
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// clearReadOnlyFields drops the values of the server managed fields decoded from an NDJSON line
+func clearReadOnlyFields(coupon *models.Coupon) {
+	coupon.ID = ""
+	coupon.RedemptionsUsed = 0
+	coupon.DiscountUsed = 0
+	coupon.RemainingRedemptions = nil
+	coupon.RemainingBudget = nil
+	coupon.HasAllowedUsers = false
+	coupon.HasDeniedUsers = false
+	coupon.CreatedAt = time.Time{}
+	coupon.UpdatedAt = time.Time{}
+}
+
+// parseCouponCSV reads the coupons from a CSV file whose header row contains the coupon json field names
+func parseCouponCSV(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+	// rows with a wrong number of cells are reported instead of failing the whole file
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header row: %w", err)
+	}
+	for i, column := range header {
+		header[i] = strings.TrimSpace(column)
+		if _, found := couponImportColumns[header[i]]; !found && !couponReadOnlyColumns[header[i]] {
+			return nil, fmt.Errorf("unknown column %q", header[i])
+		}
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := importRow{result: &models.CouponImportRow{Row: len(rows) + 1}}
+		if len(record) != len(header) {
+			row.result.Error = fmt.Sprintf("expected %d cells, found %d", len(header), len(record))
+		} else if err := decodeCSVCoupon(header, record, &row.coupon); err != nil {
+			row.result.Error = err.Error()
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// decodeCSVCoupon converts the CSV cells to the field types and decodes them as the json coupon, empty cells are left out
+func decodeCSVCoupon(header, record []string, coupon *models.Coupon) error {
+	values := make(map[string]interface{}, len(header))
+	for i, column := range header {
+		cell := strings.TrimSpace(record[i])
+		fieldType, writable := couponImportColumns[column]
+		if cell == "" || !writable {
+			continue
+		}
+
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		switch {
+		case fieldType == reflect.TypeOf([]models.DiscountTier{}):
+			tiers, err := models.ParseDiscountTiers(cell)
+			if err != nil {
+				return fmt.Errorf("%s: %s", column, err)
+			}
+			values[column] = tiers
+		case fieldType == reflect.TypeOf(time.Time{}):
+			values[column] = cell
+		case fieldType.Kind() == reflect.Slice:
+			var items []string
+			for _, item := range strings.Split(cell, importListSeparator) {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			values[column] = items
+		case fieldType.Kind() == reflect.Int:
+			n, err := strconv.Atoi(cell)
+			if err != nil {
+				return fmt.Errorf("%s must be a whole number", column)
+			}
+			values[column] = n
+		case fieldType.Kind() == reflect.Float64:
+			n, err := strconv.ParseFloat(cell, 64)
+			if err != nil {
+				return fmt.Errorf("%s must be a number", column)
+			}
+			values[column] = n
+		case fieldType.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(cell)
+			if err != nil {
+				return fmt.Errorf("%s must be true or false", column)
+			}
+			values[column] = b
+		default:
+			values[column] = cell
+		}
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, coupon); err != nil {
+		return fmt.Errorf("invalid value: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"database/sql"
+	"farmako-coupon-service/database"
+	"farmako-coupon-service/dbhelper"
+	"farmako-coupon-service/models"
+	"farmako-coupon-service/utils"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultReservationTTL = 15 * time.Minute
+	maxReservationTTL     = time.Hour
+)
+
+// ReserveCoupon godoc
+// @Summary               Reserve a coupon for an order
+// @Description           Validates the coupon at the server time and holds its usage for the order till the TTL expires, the reservation must be committed on order placement or released on payment failure. The timestamp of the request is ignored.
+// @Tags                  Coupons
+// @Accept                json
+// @Produce               json
+// @Param                 request    body      models.ReserveCouponRequest   true "Coupon reservation request"
+// @Success               201        {object}  models.CouponReservation
+// @Failure               400
+// @Failure               404
+// @Failure               409
+// @Failure               422
+// @Failure               500
+// @Router                /v1/public/coupons/reserve [post]
+func ReserveCoupon(w http.ResponseWriter, r *http.Request) {
+	var req models.ReserveCouponRequest
+	if err := utils.ParseBody(r.Body, &req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	req.CouponCode = utils.NormalizeCouponCode(req.CouponCode)
+	if req.OrderID == "" || req.UserID == "" {
+		utils.RespondError(w, http.StatusBadRequest, fmt.Errorf("order_id and user_id are required"), "Order and user are required to reserve a coupon")
+		return
+	}
+
+	if err := resolveUserContext(r, &req.ValidateCouponRequest); err != nil {
+		utils.RespondError(w, http.StatusInternalServerError, err, "Failed to fetch user context")
+		return
+	}
+
+	ttl := defaultReservationTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl > maxReservationTTL {
+		ttl = maxReservationTTL
+	}
+	// reserving redeems the coupon, so the validity window is checked at the server time and not the client's
+	req.Timestamp = time.Now()
+
+	var reservation *models.CouponReservation
+	var result *models.ValidationResult
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		reservation, result, err = dbhelper.ReserveCouponUsage(tx, req, time.Now().Add(ttl))
+		return err
+	})
+	if txErr != nil {
+		switch {
+		case errors.Is(txErr, sql.ErrNoRows):
+			utils.RespondError(w, http.StatusNotFound, txErr, "Coupon not found")
+		case errors.Is(txErr, dbhelper.ErrAlreadyReserved):
+			utils.RespondError(w, http.StatusConflict, txErr, "Coupon is already reserved for the order")
+		default:
+			utils.RespondError(w, http.StatusInternalServerError, txErr, "Failed to reserve coupon")
+		}
+		return
+	}
+	if reservation == nil {
+		utils.RespondError(w, http.StatusUnprocessableEntity, fmt.Errorf("%s", result.Message), result.Message)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, reservation)
+}
+
+// CommitCoupon godoc
+// @Summary               Commit a coupon reservation
+// @Description           Marks the coupon reserved for the order as used once the order is placed, the user must be the one the coupon was reserved for
+// @Tags                  Coupons
+// @Accept                json
+// @Produce               json
+// @Param                 request    body      models.CouponOrderRequest   true "Order of the reservation"
+// @Success               200        {object}  utils.GenericResponse
+// @Failure               400
+// @Failure               404
+// @Failure               500
+// @Router                /v1/public/coupons/commit [post]
+func CommitCoupon(w http.ResponseWriter, r *http.Request) {
+	req, ok := parseCouponOrderRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := dbhelper.CommitCouponReservation(database.FCS, req.OrderID, req.UserID); err != nil {
+		respondReservationError(w, err, "Failed to commit coupon reservation")
+		return
+	}
+	utils.Response(w, "coupon reservation committed")
+}
+
+// ReleaseCoupon godoc
+// @Summary               Release a coupon reservation
+// @Description           Releases the coupon reserved for the order on payment failure or cancellation before placement, the user must be the one the coupon was reserved for
+// @Tags                  Coupons
+// @Accept                json
+// @Produce               json
+// @Param                 request    body      models.CouponOrderRequest   true "Order of the reservation"
+// @Success               200        {object}  utils.GenericResponse
+// @Failure               400
+// @Failure               404
+// @Failure               500
+// @Router                /v1/public/coupons/release [post]
+func ReleaseCoupon(w http.ResponseWriter, r *http.Request) {
+	req, ok := parseCouponOrderRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := dbhelper.ReleaseCouponReservation(database.FCS, req.OrderID, req.UserID); err != nil {
+		respondReservationError(w, err, "Failed to release coupon reservation")
+		return
+	}
+	utils.Response(w, "coupon reservation released")
+}
+
+// parseCouponOrderRequest reads the order and the user of a reservation, both are required so that only the
+// user the coupon was reserved for can commit or release it
+func parseCouponOrderRequest(w http.ResponseWriter, r *http.Request) (models.CouponOrderRequest, bool) {
+	var req models.CouponOrderRequest
+	if err := utils.ParseBody(r.Body, &req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid request body")
+		return req, false
+	}
+	if req.OrderID == "" || req.UserID == "" {
+		utils.RespondError(w, http.StatusBadRequest, fmt.Errorf("order_id and user_id are required"), "Order and user are required")
+		return req, false
+	}
+	return req, true
+}
+
+func respondReservationError(w http.ResponseWriter, err error, messageToUser string) {
+	if errors.Is(err, dbhelper.ErrReservationNotFound) {
+		utils.RespondError(w, http.StatusNotFound, err, "No active coupon reservation found for the order")
+		return
+	}
+	utils.RespondError(w, http.StatusInternalServerError, err, messageToUser)
+}
+
+// ReverseCouponUsage godoc
+// @Summary               Reverse a coupon redemption
+// @Description           Reverses the coupon used for a cancelled or refunded order so that the use is given back to the user, the reversal is recorded in the history. Partial refunds are rejected for coupons with a discount budget
+// @Tags                  Admin
+// @Accept                json
+// @Produce               json
+// @Param                 request    body      models.ReverseCouponUsageRequest   true "Reversal request"
+// @Success               200        {array}   models.CouponUsageReversal
+// @Failure               400
+// @Failure               404
+// @Failure               409
+// @Failure               500
+// @Router                /v1/admin/coupons/usages/reverse [post]
+func ReverseCouponUsage(w http.ResponseWriter, r *http.Request) {
+	var req models.ReverseCouponUsageRequest
+	if err := utils.ParseBody(r.Body, &req); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	if req.RefundType == "" {
+		req.RefundType = models.RefundTypeFull
+	}
+	if req.OrderID == "" || req.Reason == "" {
+		utils.RespondError(w, http.StatusBadRequest, fmt.Errorf("order_id and reason are required"), "Order and reason are required to reverse a coupon")
+		return
+	}
+	if req.RefundType != models.RefundTypeFull && req.RefundType != models.RefundTypePartial {
+		utils.RespondError(w, http.StatusBadRequest, fmt.Errorf("invalid refund_type %q", req.RefundType), "Refund type must be full or partial")
+		return
+	}
+
+	var reversals []models.CouponUsageReversal
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		var err error
+		reversals, err = dbhelper.ReverseCouponUsage(tx, req)
+		return err
+	})
+	if txErr != nil {
+		if errors.Is(txErr, dbhelper.ErrRedemptionNotFound) {
+			utils.RespondError(w, http.StatusNotFound, txErr, "No coupon redemption found for the order")
+			return
+		}
+		if errors.Is(txErr, dbhelper.ErrPartialRefundWithBudget) {
+			utils.RespondError(w, http.StatusConflict, txErr, "Coupons with a discount budget can only be reversed for a full refund")
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, txErr, "Failed to reverse coupon redemption")
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, reversals)
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"database/sql"
+	"farmako-coupon-service/database"
+	"farmako-coupon-service/dbhelper"
+	"farmako-coupon-service/models"
+	"farmako-coupon-service/usercontext"
+	"farmako-coupon-service/utils"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// GetUserContext godoc
+// @Summary            Get the context of a user
+// @Description        Returns the stored order count, signup date and segments of the user used by the coupon rules
+// @Tags               Admin
+// @Produce            json
+// @Param              id     path    string   true   "User ID"
+// @Success            200    {object}  models.UserContext
+// @Failure            404
+// @Failure            500
+// @Router             /v1/admin/users/{id}/context [get]
+func GetUserContext(w http.ResponseWriter, r *http.Request) {
+	user, err := dbhelper.GetUserContext(database.FCS, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondError(w, http.StatusNotFound, err, "User context not found")
+			return
+		}
+		utils.RespondError(w, http.StatusInternalServerError, err, "Failed to fetch user context")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, user)
+}
+
+// SaveUserContext godoc
+// @Summary            Save the context of a user
+// @Description        Creates or replaces the order count, signup date and segments of the user, called by the user and order services whenever they change
+// @Tags               Admin
+// @Accept             json
+// @Produce            json
+// @Param              id     path    string               true   "User ID"
+// @Param              user   body    models.UserContext   true   "User context"
+// @Success            200    {object}  models.UserContext
+// @Failure            400
+// @Failure            422    {object}  utils.RequestErr
+// @Failure            500
+// @Router             /v1/admin/users/{id}/context [put]
+func SaveUserContext(w http.ResponseWriter, r *http.Request) {
+	var user models.UserContext
+	if err := utils.ParseBody(r.Body, &user); err != nil {
+		utils.RespondError(w, http.StatusBadRequest, err, "Invalid request body")
+		return
+	}
+	user.UserID = chi.URLParam(r, "id")
+	if err := utils.ValidateStruct(user); err != nil {
+		utils.RespondError(w, http.StatusUnprocessableEntity, err, "Invalid user context")
+		return
+	}
+
+	txErr := database.Tx(func(tx *sqlx.Tx) error {
+		return dbhelper.UpsertUserContext(tx, user)
+	})
+	if txErr != nil {
+		utils.RespondError(w, http.StatusInternalServerError, txErr, "Failed to save user context")
+		return
+	}
+	utils.RespondJSON(w, http.StatusOK, user)
+}
+
+// resolveUserContext sets the context of the user of the request from the default provider
+func resolveUserContext(r *http.Request, req *models.ValidateCouponRequest) error {
+	user, err := usercontext.Resolve(r.Context(), req.UserID)
+	if err != nil {
+		return err
+	}
+	req.User = user
+	return nil
+}
@@ -0,0 +1,21 @@
+package models
+
+const (
+	AudienceListAllow = "allow"
+	AudienceListDeny  = "deny"
+)
+
+// IsAudienceList returns true if the list is either the allowlist or the denylist
+func IsAudienceList(list string) bool {
+	return list == AudienceListAllow || list == AudienceListDeny
+}
+
+// CouponUserListReport is the outcome of a user list upload, Total is the size of the list after the upload
+type CouponUserListReport struct {
+	CouponID string `json:"coupon_id"`
+	List     string `json:"list"`
+	Replaced bool   `json:"replaced"`
+	Received int    `json:"received"`
+	Added    int64  `json:"added"`
+	Total    int    `json:"total"`
+}
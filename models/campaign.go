@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type CouponCampaign struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Prefix    string    `json:"prefix" db:"prefix"`
+	CodeCount int       `json:"code_count" db:"code_count"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type CreateCampaignRequest struct {
+	Name string `json:"name" validate:"required"`
+	// Prefix is added before every generated code
+	Prefix string `json:"prefix"`
+	Count  int    `json:"count" validate:"gt=0,lte=100000"`
+	// CodeLength is the number of generated characters after the prefix, 8 by default
+	CodeLength int `json:"code_length" validate:"omitempty,gte=6,lte=32"`
+	// Alphabet contains the characters used to generate the codes, ambiguous characters like 0/O and 1/I are left out by default
+	Alphabet string `json:"alphabet" validate:"omitempty,min=10"`
+	// Coupon contains the rules shared by all the codes of the campaign, its coupon_code is ignored and its
+	// max_total_redemptions is 1 by default
+	Coupon Coupon `json:"coupon"`
+}
+
+// CampaignCode is a generated code of a campaign as exported in the CSV
+type CampaignCode struct {
+	CouponCode string    `db:"coupon_code"`
+	Status     string    `db:"status"`
+	ExpiryDate time.Time `db:"expiry_date"`
+}
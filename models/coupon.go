@@ -1,45 +1,326 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	DiscountTypePercentage = "percentage"
+	DiscountTypeFixed      = "fixed"
+	DiscountTypeBuyXGetY   = "buy_x_get_y"
+	DiscountTypeTiered     = "tiered"
+)
+
+const (
+	TargetInventory = "inventory"
+	TargetCharges   = "charges"
+)
+
+const (
+	UsageTypeOneTime   = "one_time"
+	UsageTypeMultiUse  = "multi_use"
+	UsageTypeTimeBased = "time_based"
+)
+
+const (
+	CouponStatusDraft    = "draft"
+	CouponStatusActive   = "active"
+	CouponStatusPaused   = "paused"
+	CouponStatusArchived = "archived"
+)
+
+// couponStatusTransitions contains the statuses a coupon can move to from each status, archived coupons are final
+var couponStatusTransitions = map[string][]string{
+	CouponStatusDraft:  {CouponStatusActive, CouponStatusArchived},
+	CouponStatusActive: {CouponStatusPaused, CouponStatusArchived},
+	CouponStatusPaused: {CouponStatusActive, CouponStatusArchived},
+}
+
+// CanTransitionStatus returns true if a coupon can move from one status to the other
+func CanTransitionStatus(from, to string) bool {
+	for _, status := range couponStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+type ChargeType string
+
+const (
+	ChargeTypeDelivery    ChargeType = "delivery"
+	ChargeTypePackaging   ChargeType = "packaging"
+	ChargeTypeConvenience ChargeType = "convenience"
+	ChargeTypePlatform    ChargeType = "platform"
+)
 
 type Coupon struct {
-	ID                    string    `json:"id" db:"id"`
-	CouponCode            string    `json:"coupon_code" db:"coupon_code"`
-	ExpiryDate            time.Time `json:"expiry_date" db:"expiry_date"`
-	UsageType             string    `json:"usage_type" db:"usage_type"`
-	ApplicableMedicineIDs []string  `json:"applicable_medicine_ids"`
-	ApplicableCategories  []string  `json:"applicable_categories"`
-	MinOrderValue         float64   `json:"min_order_value" db:"min_order_value"`
-	ValidFrom             time.Time `json:"valid_from" db:"valid_from"`
-	ValidTo               time.Time `json:"valid_to" db:"valid_to"`
-	Terms                 string    `json:"terms_and_conditions" db:"terms_and_conditions"`
-	DiscountType          string    `json:"discount_type" db:"discount_type"`
-	DiscountValue         float64   `json:"discount_value" db:"discount_value"`
-	MaxUsagePerUser       int       `json:"max_usage_per_user" db:"max_usage_per_user"`
-	Target                string    `json:"target" db:"target"`
+	ID                    string         `json:"id" db:"id"`
+	CouponCode            string         `json:"coupon_code" db:"coupon_code" validate:"required,coupon_code"`
+	ExpiryDate            time.Time      `json:"expiry_date" db:"expiry_date" validate:"required"`
+	UsageType             string         `json:"usage_type" db:"usage_type" validate:"required,oneof=one_time multi_use time_based"`
+	ApplicableMedicineIDs []string       `json:"applicable_medicine_ids" db:"-" validate:"dive,required"`
+	ApplicableCategories  []string       `json:"applicable_categories" db:"-" validate:"dive,required"`
+	ApplicableCharges     []ChargeType   `json:"applicable_charges" db:"-" validate:"dive,oneof=delivery packaging convenience platform"`
+	MinOrderValue         float64        `json:"min_order_value" db:"min_order_value" validate:"gte=0"`
+	ValidFrom             *time.Time     `json:"valid_from" db:"valid_from"`
+	ValidTo               *time.Time     `json:"valid_to" db:"valid_to"`
+	Terms                 string         `json:"terms_and_conditions" db:"terms_and_conditions"`
+	DiscountType          string         `json:"discount_type" db:"discount_type" validate:"required,oneof=percentage fixed buy_x_get_y tiered"`
+	DiscountValue         float64        `json:"discount_value" db:"discount_value" validate:"gte=0"`
+	BuyQuantity           int            `json:"buy_quantity" db:"buy_quantity" validate:"gte=0"`
+	GetQuantity           int            `json:"get_quantity" db:"get_quantity" validate:"gte=0"`
+	RewardMedicineID      string         `json:"reward_medicine_id" db:"reward_medicine_id"`
+	DiscountTiers         []DiscountTier `json:"discount_tiers" db:"-" validate:"unique=MinSubtotal,dive"`
+	EligibilityRule       string         `json:"eligibility_rule" db:"eligibility_rule" validate:"omitempty,eligibility_rule"`
+	FirstOrderOnly        bool           `json:"first_order_only" db:"first_order_only"`
+	SignupWithinDays      int            `json:"signup_within_days" db:"signup_within_days" validate:"gte=0"`
+	AllowedSegments       []string       `json:"allowed_segments" db:"-" validate:"unique,dive,required"`
+	DeniedSegments        []string       `json:"denied_segments" db:"-" validate:"unique,dive,required"`
+	MaxDiscountAmount     float64        `json:"max_discount_amount" db:"max_discount_amount" validate:"gte=0"`
+	MaxUsagePerUser       int            `json:"max_usage_per_user" db:"max_usage_per_user" validate:"gte=0"`
+	MaxTotalRedemptions   int            `json:"max_total_redemptions" db:"max_total_redemptions" validate:"gte=0"`
+	DiscountBudget        float64        `json:"discount_budget" db:"discount_budget" validate:"gte=0"`
+	Target                string         `json:"target" db:"target" validate:"required,oneof=inventory charges"`
+	Stackable             bool           `json:"stackable" db:"stackable"`
+	ExclusivityGroup      string         `json:"exclusivity_group" db:"exclusivity_group"`
+	// RedemptionsUsed and DiscountUsed count the committed and reserved usages, they are maintained by the redemptions
+	RedemptionsUsed int     `json:"redemptions_used" db:"redemptions_used"`
+	DiscountUsed    float64 `json:"discount_used" db:"discount_used"`
+	// RemainingRedemptions and RemainingBudget are left out when the coupon has no such cap
+	RemainingRedemptions *int     `json:"remaining_redemptions,omitempty" db:"remaining_redemptions"`
+	RemainingBudget      *float64 `json:"remaining_budget,omitempty" db:"remaining_budget"`
+	// HasAllowedUsers and HasDeniedUsers are set once user lists are uploaded through the coupon user list endpoints
+	HasAllowedUsers bool `json:"has_allowed_users" db:"has_allowed_users"`
+	HasDeniedUsers  bool `json:"has_denied_users" db:"has_denied_users"`
+	// Status can only be changed through the status endpoints once the coupon is created
+	Status    string    `json:"status" db:"status" validate:"omitempty,oneof=draft active paused archived"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// CouponFilter contains the filters and pagination for listing the coupons
+type CouponFilter struct {
+	Code          string
+	Status        string
+	Target        string
+	DiscountType  string
+	UsageType     string
+	ExpiresAfter  *time.Time
+	ExpiresBefore *time.Time
+	// ActiveAt lists the coupons usable at the given time
+	ActiveAt *time.Time
+	Limit    int
+	Offset   int
+}
+
+type CouponList struct {
+	Coupons []Coupon `json:"coupons"`
+	Total   int      `json:"total"`
+	Limit   int      `json:"limit"`
+	Offset  int      `json:"offset"`
+}
+
+// CouponExport is an exported coupon along with its usage counts, DiscountGiven is the discount of the committed usages
+type CouponExport struct {
+	Coupon
+	RedemptionCount int     `json:"redemption_count" db:"redemption_count"`
+	ReservedCount   int     `json:"reserved_count" db:"reserved_count"`
+	ReversedCount   int     `json:"reversed_count" db:"reversed_count"`
+	DiscountGiven   float64 `json:"discount_given" db:"discount_given"`
+}
+
+// CouponStructLevelValidation validates the rules spanning multiple fields of a coupon, percentage discounts can be
+// at most 100, buy x get y coupons need both the quantities, tiered coupons need their tiers, time based coupons
+// need their validity window and valid_from < valid_to <= expiry_date
+func CouponStructLevelValidation(sl validator.StructLevel) {
+	coupon := sl.Current().Interface().(Coupon)
+
+	switch coupon.DiscountType {
+	case DiscountTypePercentage, DiscountTypeFixed:
+		if coupon.DiscountValue <= 0 {
+			sl.ReportError(coupon.DiscountValue, "discount_value", "DiscountValue", "gt", "0")
+		}
+		if coupon.DiscountType == DiscountTypePercentage && coupon.DiscountValue > 100 {
+			sl.ReportError(coupon.DiscountValue, "discount_value", "DiscountValue", "lte", "100")
+		}
+	case DiscountTypeBuyXGetY:
+		if coupon.BuyQuantity <= 0 {
+			sl.ReportError(coupon.BuyQuantity, "buy_quantity", "BuyQuantity", "gt", "0")
+		}
+		if coupon.GetQuantity <= 0 {
+			sl.ReportError(coupon.GetQuantity, "get_quantity", "GetQuantity", "gt", "0")
+		}
+		if coupon.Target != TargetInventory {
+			sl.ReportError(coupon.Target, "target", "Target", "oneof", TargetInventory)
+		}
+	case DiscountTypeTiered:
+		if len(coupon.DiscountTiers) == 0 {
+			sl.ReportError(coupon.DiscountTiers, "discount_tiers", "DiscountTiers", "required", "")
+		}
+		for i, tier := range coupon.DiscountTiers {
+			if tier.DiscountType == DiscountTypePercentage && tier.DiscountValue > 100 {
+				sl.ReportError(tier.DiscountValue, fmt.Sprintf("discount_tiers[%d].discount_value", i), "DiscountValue", "lte", "100")
+			}
+		}
+		if coupon.Target != TargetInventory {
+			sl.ReportError(coupon.Target, "target", "Target", "oneof", TargetInventory)
+		}
+	}
+	// time based coupons count the usages of their validity window
+	if coupon.UsageType == UsageTypeTimeBased {
+		if coupon.ValidFrom == nil {
+			sl.ReportError(coupon.ValidFrom, "valid_from", "ValidFrom", "required", "")
+		}
+		if coupon.ValidTo == nil {
+			sl.ReportError(coupon.ValidTo, "valid_to", "ValidTo", "required", "")
+		}
+	}
+	if coupon.ValidFrom != nil && coupon.ValidTo != nil && !coupon.ValidFrom.Before(*coupon.ValidTo) {
+		sl.ReportError(coupon.ValidFrom, "valid_from", "ValidFrom", "ltfield", "valid_to")
+	}
+	if coupon.ValidFrom != nil && !coupon.ValidFrom.Before(coupon.ExpiryDate) {
+		sl.ReportError(coupon.ValidFrom, "valid_from", "ValidFrom", "ltfield", "expiry_date")
+	}
+	if coupon.ValidTo != nil && coupon.ValidTo.After(coupon.ExpiryDate) {
+		sl.ReportError(coupon.ValidTo, "valid_to", "ValidTo", "ltefield", "expiry_date")
+	}
+}
+
+// IsPrivate returns true if the coupon has an allowlist, private coupons apply only to the allowed users and segments
+func (c *Coupon) IsPrivate() bool {
+	return c.HasAllowedUsers || len(c.AllowedSegments) > 0
+}
+
+// UsageLimit returns the number of times a user can use the coupon, zero means unlimited usage.
+// One time coupons can be used only once while other coupons are capped by max usage per user.
+func (c *Coupon) UsageLimit() int {
+	if c.UsageType == UsageTypeOneTime {
+		return 1
+	}
+	if c.MaxUsagePerUser < 0 {
+		return 0
+	}
+	return c.MaxUsagePerUser
+}
+
+type CouponStatusRequest struct {
+	Status    string `json:"status" validate:"required,oneof=draft active paused archived"`
+	ChangedBy string `json:"changed_by" validate:"required"`
+	Reason    string `json:"reason"`
+}
+
+type CouponStatusChange struct {
+	ID         int       `json:"id" db:"id"`
+	CouponID   string    `json:"coupon_id" db:"coupon_id"`
+	FromStatus string    `json:"from_status" db:"from_status"`
+	ToStatus   string    `json:"to_status" db:"to_status"`
+	ChangedBy  string    `json:"changed_by" db:"changed_by"`
+	Reason     string    `json:"reason" db:"reason"`
+	ChangedAt  time.Time `json:"changed_at" db:"changed_at"`
 }
 
 type CartItem struct {
-	ID       string `json:"id"`
-	Category string `json:"category"`
+	ID       string  `json:"id"`
+	Category string  `json:"category"`
+	Price    float64 `json:"price"`
+	Quantity int     `json:"quantity"`
+}
+
+// Units returns the quantity of the cart item, an item without quantity counts as a single unit
+func (item CartItem) Units() int {
+	if item.Quantity <= 0 {
+		return 1
+	}
+	return item.Quantity
+}
+
+// LineTotal returns the total price of the cart item
+func (item CartItem) LineTotal() float64 {
+	return item.Price * float64(item.Units())
+}
+
+// Charge is a fee line of the order like delivery or packaging fee
+type Charge struct {
+	Type   ChargeType `json:"type"`
+	Amount float64    `json:"amount"`
 }
 
 type ApplicableCoupon struct {
 	CouponCode    string  `json:"coupon_code" db:"coupon_code"`
 	DiscountValue float64 `json:"discount_value" db:"discount_value"`
+	// MaxDiscountAmount is the most the coupon can save, zero means no cap
+	MaxDiscountAmount float64 `json:"max_discount_amount,omitempty" db:"max_discount_amount"`
+	// NextTier is the next slab of a tiered coupon, left out at the highest slab
+	NextTier *NextDiscountTier `json:"next_tier,omitempty"`
+	// Discount is the discount of the coupon for the given cart
+	Discount DiscountBreakdown `json:"discount"`
+	// Savings is the total discount of the coupon for the given cart
+	Savings float64 `json:"savings"`
+	// IsBest is set for the coupon giving the highest savings
+	IsBest bool `json:"is_best"`
+}
+
+// AlmostApplicableCoupon is a coupon the cart does not qualify for yet, Reason tells what is missing
+type AlmostApplicableCoupon struct {
+	CouponCode        string  `json:"coupon_code"`
+	DiscountValue     float64 `json:"discount_value"`
+	MaxDiscountAmount float64 `json:"max_discount_amount,omitempty"`
+	Reason            string  `json:"reason"`
+	// Shortfall is the amount to add to the order to unlock the coupon
+	Shortfall float64 `json:"shortfall"`
+}
+
+// ApplicableCoupons contains the applicable coupons sorted by savings, highest first, and the coupons
+// which become applicable on adding more to the order sorted by the shortfall, lowest first
+type ApplicableCoupons struct {
+	Coupons          []ApplicableCoupon       `json:"applicable_coupons"`
+	AlmostApplicable []AlmostApplicableCoupon `json:"almost_applicable_coupons"`
 }
 
 type ValidateCouponRequest struct {
 	CouponCode string     `json:"coupon_code" db:"coupon_code"`
-	UserID     string     `json:"user_id db:"user_id`
+	UserID     string     `json:"user_id" db:"user_id"`
 	CartItems  []CartItem `json:"cart_items" db:"cart_item"`
+	Charges    []Charge   `json:"charges"`
 	OrderTotal float64    `json:"order_total" db:"order_total"`
 	Timestamp  time.Time  `json:"timestamp" db:"timestamp"`
+	// User is the context of the user, resolved from the UserID by the handlers before validating
+	User *UserContext `json:"-" db:"-"`
 }
 
 type DiscountBreakdown struct {
 	ItemsDiscount   float64 `json:"items_discount"`
 	ChargesDiscount float64 `json:"charges_discount"`
+	// ChargeDiscounts contains the discount given on each charge type
+	ChargeDiscounts map[ChargeType]float64 `json:"charge_discounts,omitempty"`
+}
+
+// Total returns the discount on the items and the charges together
+func (d DiscountBreakdown) Total() float64 {
+	return d.ItemsDiscount + d.ChargesDiscount
+}
+
+// Add returns the sum of both the discounts
+func (d DiscountBreakdown) Add(other DiscountBreakdown) DiscountBreakdown {
+	sum := DiscountBreakdown{
+		ItemsDiscount:   d.ItemsDiscount + other.ItemsDiscount,
+		ChargesDiscount: d.ChargesDiscount + other.ChargesDiscount,
+	}
+	if len(d.ChargeDiscounts) > 0 || len(other.ChargeDiscounts) > 0 {
+		sum.ChargeDiscounts = make(map[ChargeType]float64)
+		for chargeType, amount := range d.ChargeDiscounts {
+			sum.ChargeDiscounts[chargeType] += amount
+		}
+		for chargeType, amount := range other.ChargeDiscounts {
+			sum.ChargeDiscounts[chargeType] += amount
+		}
+	}
+	return sum
 }
 
 type ValidationResult struct {
@@ -0,0 +1,19 @@
+package models
+
+// CouponImportRow is the outcome of importing a single row, rows are numbered from 1 without the CSV header
+type CouponImportRow struct {
+	Row        int               `json:"row"`
+	CouponCode string            `json:"coupon_code,omitempty"`
+	CouponID   string            `json:"coupon_id,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// CouponImportReport contains the outcome of every imported row, nothing is saved on a dry run
+type CouponImportReport struct {
+	DryRun    bool              `json:"dry_run"`
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Rows      []CouponImportRow `json:"rows"`
+}
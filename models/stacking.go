@@ -0,0 +1,22 @@
+package models
+
+// CombinedValidationRequest validates several coupon codes on the same cart, coupon_code is ignored
+type CombinedValidationRequest struct {
+	ValidateCouponRequest
+	CouponCodes []string `json:"coupon_codes"`
+}
+
+// CombinedCouponResult is the outcome of a coupon in a combined validation, Message tells why a coupon is not applied
+type CombinedCouponResult struct {
+	CouponCode string            `json:"coupon_code"`
+	Applied    bool              `json:"applied"`
+	Discount   DiscountBreakdown `json:"discount"`
+	Message    string            `json:"message"`
+}
+
+// CombinedValidationResult contains the outcome of every requested coupon and the total discount of the applied ones
+type CombinedValidationResult struct {
+	IsValid  bool                   `json:"is_valid"`
+	Coupons  []CombinedCouponResult `json:"coupons"`
+	Discount DiscountBreakdown      `json:"discount"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DiscountTier is a slab of a tiered coupon, it applies once the eligible subtotal reaches MinSubtotal
+type DiscountTier struct {
+	MinSubtotal   float64 `json:"min_subtotal" db:"min_subtotal" validate:"gt=0"`
+	DiscountType  string  `json:"discount_type" db:"discount_type" validate:"required,oneof=percentage fixed"`
+	DiscountValue float64 `json:"discount_value" db:"discount_value" validate:"gt=0"`
+}
+
+// NextDiscountTier is the next slab of a tiered coupon along with the amount to add to reach it
+type NextDiscountTier struct {
+	DiscountTier
+	Shortfall float64 `json:"shortfall"`
+}
+
+// FormatDiscountTiers writes the tiers as min_subtotal:discount_type:discount_value separated by "|"
+func FormatDiscountTiers(tiers []DiscountTier) string {
+	formatted := make([]string, 0, len(tiers))
+	for _, tier := range tiers {
+		formatted = append(formatted, fmt.Sprintf("%s:%s:%s", strconv.FormatFloat(tier.MinSubtotal, 'f', -1, 64),
+			tier.DiscountType, strconv.FormatFloat(tier.DiscountValue, 'f', -1, 64)))
+	}
+	return strings.Join(formatted, "|")
+}
+
+// ParseDiscountTiers reads the tiers written by FormatDiscountTiers
+func ParseDiscountTiers(value string) ([]DiscountTier, error) {
+	tiers := []DiscountTier{}
+	for _, formatted := range strings.Split(value, "|") {
+		if formatted = strings.TrimSpace(formatted); formatted == "" {
+			continue
+		}
+
+		parts := strings.Split(formatted, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("tier %q must be min_subtotal:discount_type:discount_value", formatted)
+		}
+		minSubtotal, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("tier %q has an invalid min_subtotal", formatted)
+		}
+		discountValue, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("tier %q has an invalid discount_value", formatted)
+		}
+		tiers = append(tiers, DiscountTier{MinSubtotal: minSubtotal, DiscountType: strings.TrimSpace(parts[1]), DiscountValue: discountValue})
+	}
+	return tiers, nil
+}
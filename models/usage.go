@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+const (
+	UsageStatusReserved  = "reserved"
+	UsageStatusCommitted = "committed"
+	UsageStatusReleased  = "released"
+	UsageStatusReversed  = "reversed"
+)
+
+const (
+	RefundTypeFull    = "full"
+	RefundTypePartial = "partial"
+)
+
+type CouponUsage struct {
+	ID             int        `json:"id" db:"id"`
+	CouponID       string     `json:"coupon_id" db:"coupon_id"`
+	UserID         string     `json:"user_id" db:"user_id"`
+	OrderID        string     `json:"order_id" db:"order_id"`
+	Status         string     `json:"status" db:"status"`
+	DiscountAmount float64    `json:"discount_amount" db:"discount_amount"`
+	UsedAt         time.Time  `json:"used_at" db:"used_at"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+}
+
+type ReserveCouponRequest struct {
+	ValidateCouponRequest
+	OrderID string `json:"order_id"`
+	// TTLSeconds is the time for which the usage stays reserved for the order
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+type CouponOrderRequest struct {
+	OrderID string `json:"order_id"`
+	// UserID must be the user the coupon was reserved for
+	UserID string `json:"user_id"`
+}
+
+type CouponReservation struct {
+	Usage    CouponUsage       `json:"usage"`
+	Discount DiscountBreakdown `json:"discount"`
+}
+
+type ReverseCouponUsageRequest struct {
+	OrderID string `json:"order_id"`
+	// RefundType is either full or partial, defaults to full
+	RefundType     string  `json:"refund_type"`
+	RefundedAmount float64 `json:"refunded_amount"`
+	Reason         string  `json:"reason"`
+	ReversedBy     string  `json:"reversed_by"`
+}
+
+type CouponUsageReversal struct {
+	ID             int       `json:"id" db:"id"`
+	UsageID        int       `json:"usage_id" db:"usage_id"`
+	CouponID       string    `json:"coupon_id" db:"coupon_id"`
+	UserID         string    `json:"user_id" db:"user_id"`
+	OrderID        string    `json:"order_id" db:"order_id"`
+	RefundType     string    `json:"refund_type" db:"refund_type"`
+	RefundedAmount float64   `json:"refunded_amount" db:"refunded_amount"`
+	Reason         string    `json:"reason" db:"reason"`
+	ReversedBy     string    `json:"reversed_by" db:"reversed_by"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// UserContext is what the coupon rules know about a user, SignupDate is nil when it is not known
+type UserContext struct {
+	UserID     string     `json:"user_id" db:"user_id"`
+	OrderCount int        `json:"order_count" db:"order_count" validate:"gte=0"`
+	SignupDate *time.Time `json:"signup_date" db:"signed_up_at"`
+	Segments   []string   `json:"segments" db:"-" validate:"unique,dive,required"`
+}
+
+// DaysSinceSignup returns the number of whole days from the signup till the given time, false if the signup
+// date is not known
+func (u *UserContext) DaysSinceSignup(at time.Time) (int, bool) {
+	if u.SignupDate == nil {
+		return 0, false
+	}
+	days := int(at.Sub(*u.SignupDate).Hours() / 24)
+	if days < 0 {
+		days = 0
+	}
+	return days, true
+}
@@ -0,0 +1,74 @@
+package rules
+
+import (
+	"farmako-coupon-service/models"
+	"strings"
+)
+
+// EligibilitySchema contains the variables a coupon eligibility rule can use
+var EligibilitySchema = Schema{
+	"cart.total":             TypeNumber,
+	"cart.subtotal":          TypeNumber,
+	"cart.item_count":        TypeNumber,
+	"cart.charges_total":     TypeNumber,
+	"cart.categories":        TypeList,
+	"cart.medicine_ids":      TypeList,
+	"user.id":                TypeString,
+	"user.order_count":       TypeNumber,
+	"user.days_since_signup": TypeNumber,
+	"user.segments":          TypeList,
+	"order.hour":             TypeNumber,
+	"order.weekday":          TypeString,
+}
+
+// CompileEligibility compiles a coupon eligibility rule against the EligibilitySchema
+func CompileEligibility(source string) (*Rule, error) {
+	return Compile(source, EligibilitySchema)
+}
+
+// EligibilityContext builds the context of the eligibility rules from the validation request. cart.total is
+// the order total, or the items and charges together when the order total is not given. The user variables
+// are left out when the context of the user is not known.
+func EligibilityContext(req models.ValidateCouponRequest) Context {
+	var subtotal, itemCount, chargesTotal float64
+	categories := []string{}
+	medicineIDs := []string{}
+	seenCategories := make(map[string]bool)
+	for _, item := range req.CartItems {
+		subtotal += item.LineTotal()
+		itemCount += float64(item.Units())
+		medicineIDs = append(medicineIDs, item.ID)
+		if item.Category != "" && !seenCategories[item.Category] {
+			seenCategories[item.Category] = true
+			categories = append(categories, item.Category)
+		}
+	}
+	for _, charge := range req.Charges {
+		chargesTotal += charge.Amount
+	}
+
+	total := req.OrderTotal
+	if total <= 0 {
+		total = subtotal + chargesTotal
+	}
+
+	ctx := Context{
+		"cart.total":         total,
+		"cart.subtotal":      subtotal,
+		"cart.item_count":    itemCount,
+		"cart.charges_total": chargesTotal,
+		"cart.categories":    categories,
+		"cart.medicine_ids":  medicineIDs,
+		"user.id":            req.UserID,
+		"order.hour":         float64(req.Timestamp.Hour()),
+		"order.weekday":      strings.ToLower(req.Timestamp.Weekday().String()),
+	}
+	if req.User != nil {
+		ctx["user.order_count"] = float64(req.User.OrderCount)
+		ctx["user.segments"] = append([]string{}, req.User.Segments...)
+		if days, known := req.User.DaysSinceSignup(req.Timestamp); known {
+			ctx["user.days_since_signup"] = float64(days)
+		}
+	}
+	return ctx
+}
@@ -0,0 +1,109 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators are matched longest first so that <= is not read as <
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!"}
+
+// tokenize splits the rule into tokens, the position of a token is its byte offset in the rule
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	for pos := 0; pos < len(source); {
+		char := rune(source[pos])
+		switch {
+		case unicode.IsSpace(char):
+			pos++
+		case char == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", pos: pos})
+			pos++
+		case char == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", pos: pos})
+			pos++
+		case char == '"' || char == '\'':
+			text, end, err := readString(source, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: pos})
+			pos = end
+		case char >= '0' && char <= '9':
+			end := pos
+			for end < len(source) && (source[end] >= '0' && source[end] <= '9' || source[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[pos:end], pos: pos})
+			pos = end
+		case char == '_' || isAlphaNumeric(source[pos]):
+			end := pos
+			for end < len(source) && (source[end] == '_' || source[end] == '.' || isAlphaNumeric(source[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[pos:end], pos: pos})
+			pos = end
+		default:
+			operator := ""
+			for _, candidate := range operators {
+				if strings.HasPrefix(source[pos:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				char, _ = utf8.DecodeRuneInString(source[pos:])
+				return nil, fmt.Errorf("unexpected character %q at position %d", char, pos)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: operator, pos: pos})
+			pos += len(operator)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+// readString reads the quoted string starting at pos and returns its value along with the position after it,
+// a backslash escapes the next character
+func readString(source string, pos int) (string, int, error) {
+	quote := source[pos]
+	var value strings.Builder
+	for end := pos + 1; end < len(source); end++ {
+		switch source[end] {
+		case '\\':
+			if end+1 == len(source) {
+				return "", 0, fmt.Errorf("unterminated string at position %d", pos)
+			}
+			end++
+			value.WriteByte(source[end])
+		case quote:
+			return value.String(), end + 1, nil
+		default:
+			value.WriteByte(source[end])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string at position %d", pos)
+}
+
+func isAlphaNumeric(char byte) bool {
+	return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9'
+}
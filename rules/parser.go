@@ -0,0 +1,182 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// maxDepth limits the nesting of a rule so that a hostile rule can not exhaust the stack
+const maxDepth = 32
+
+// parser builds the expression tree with one function per precedence level, lowest first:
+// ||, &&, !, comparisons (== != < <= > >= in) and the operands
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func parse(source string) (expr, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", next.text, next.pos)
+	}
+	return root, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isOperator returns true if the next token is one of the operators, the in keyword counts as an operator
+func (p *parser) isOperator(operators ...string) bool {
+	t := p.peek()
+	if t.kind != tokenOperator && !(t.kind == tokenIdent && t.text == "in") {
+		return false
+	}
+	for _, operator := range operators {
+		if t.text == operator {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||") {
+		operator := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{operator: operator.text, left: left, right: right, pos: operator.pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&") {
+		operator := p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{operator: operator.text, left: left, right: right, pos: operator.pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if !p.isOperator("!") {
+		return p.parseComparison()
+	}
+
+	operator := p.next()
+	if err := p.enter(operator); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return &notExpr{operand: operand, pos: operator.pos}, nil
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOperator("==", "!=", "<", "<=", ">", ">=", "in") {
+		return left, nil
+	}
+
+	operator := p.next()
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOperator("==", "!=", "<", "<=", ">", ">=", "in") {
+		return nil, fmt.Errorf("comparisons can not be chained, use && at position %d", p.peek().pos)
+	}
+	return &binaryExpr{operator: operator.text, left: left, right: right, pos: operator.pos}, nil
+}
+
+func (p *parser) parseOperand() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", t.text, t.pos)
+		}
+		return &literalExpr{value: value, typ: TypeNumber}, nil
+	case tokenString:
+		return &literalExpr{value: t.text, typ: TypeString}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true", "false":
+			return &literalExpr{value: t.text == "true", typ: TypeBool}, nil
+		case "in":
+			return nil, fmt.Errorf("unexpected \"in\" at position %d", t.pos)
+		}
+		return &variableExpr{name: t.text, pos: t.pos}, nil
+	case tokenLeftParen:
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRightParen {
+			return nil, fmt.Errorf("expected \")\" at position %d", closing.pos)
+		}
+		return inner, nil
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of rule at position %d", t.pos)
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+}
+
+func (p *parser) enter(t token) error {
+	p.depth++
+	if p.depth > maxDepth {
+		return fmt.Errorf("rule is nested too deeply at position %d", t.pos)
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
@@ -0,0 +1,260 @@
+// Package rules compiles and evaluates the coupon eligibility rules, a small expression language like
+// cart.total >= 999 && "diabetes" in cart.categories. A rule can only read the variables of its schema
+// and compare them, there are no loops, assignments or function calls.
+package rules
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxLength is the longest rule accepted
+const MaxLength = 1000
+
+// ErrMissingVariable is returned by Evaluate when a variable of the rule is not in the context
+var ErrMissingVariable = errors.New("variable is missing from the context")
+
+// Type is the type of a value in a rule
+type Type int
+
+const (
+	TypeNumber Type = iota + 1
+	TypeString
+	TypeBool
+	// TypeList is a list of strings, only usable on the right of the in operator
+	TypeList
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeNumber:
+		return "number"
+	case TypeString:
+		return "string"
+	case TypeBool:
+		return "bool"
+	case TypeList:
+		return "list"
+	default:
+		return "unknown"
+	}
+}
+
+// Schema contains the variables a rule can use along with their types
+type Schema map[string]Type
+
+// Context contains the value of every variable of the schema, numbers are float64, lists are []string
+type Context map[string]interface{}
+
+// Rule is a parsed and type checked rule
+type Rule struct {
+	source string
+	root   expr
+}
+
+// Compile parses the rule and checks that it only uses the variables of the schema with the right types
+// and evaluates to a bool
+func Compile(source string, schema Schema) (*Rule, error) {
+	if len(source) > MaxLength {
+		return nil, fmt.Errorf("rule is longer than %d characters", MaxLength)
+	}
+
+	root, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	typ, err := root.check(schema)
+	if err != nil {
+		return nil, err
+	}
+	if typ != TypeBool {
+		return nil, fmt.Errorf("rule must be true or false, found a %s", typ)
+	}
+	return &Rule{source: source, root: root}, nil
+}
+
+// Evaluate returns true if the context satisfies the rule, an error is returned if a variable is missing
+// from the context or has a value of the wrong type
+func (r *Rule) Evaluate(ctx Context) (bool, error) {
+	value, err := r.root.eval(ctx)
+	if err != nil {
+		return false, err
+	}
+	return value.(bool), nil
+}
+
+func (r *Rule) String() string {
+	return r.source
+}
+
+// expr is a node of a parsed rule, check is run once at compile time so that eval can rely on the types
+type expr interface {
+	check(schema Schema) (Type, error)
+	eval(ctx Context) (interface{}, error)
+}
+
+type literalExpr struct {
+	value interface{}
+	typ   Type
+}
+
+func (e *literalExpr) check(Schema) (Type, error) {
+	return e.typ, nil
+}
+
+func (e *literalExpr) eval(Context) (interface{}, error) {
+	return e.value, nil
+}
+
+type variableExpr struct {
+	name string
+	typ  Type
+	pos  int
+}
+
+func (e *variableExpr) check(schema Schema) (Type, error) {
+	typ, found := schema[e.name]
+	if !found {
+		return 0, fmt.Errorf("unknown variable %s at position %d", e.name, e.pos)
+	}
+	e.typ = typ
+	return typ, nil
+}
+
+func (e *variableExpr) eval(ctx Context) (interface{}, error) {
+	value, found := ctx[e.name]
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrMissingVariable, e.name)
+	}
+
+	var valid bool
+	switch e.typ {
+	case TypeNumber:
+		_, valid = value.(float64)
+	case TypeString:
+		_, valid = value.(string)
+	case TypeBool:
+		_, valid = value.(bool)
+	case TypeList:
+		_, valid = value.([]string)
+	}
+	if !valid {
+		return nil, fmt.Errorf("variable %s must be a %s, found %T", e.name, e.typ, value)
+	}
+	return value, nil
+}
+
+type notExpr struct {
+	operand expr
+	pos     int
+}
+
+func (e *notExpr) check(schema Schema) (Type, error) {
+	typ, err := e.operand.check(schema)
+	if err != nil {
+		return 0, err
+	}
+	if typ != TypeBool {
+		return 0, fmt.Errorf("! needs a bool, found a %s at position %d", typ, e.pos)
+	}
+	return TypeBool, nil
+}
+
+func (e *notExpr) eval(ctx Context) (interface{}, error) {
+	value, err := e.operand.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return !value.(bool), nil
+}
+
+type binaryExpr struct {
+	operator    string
+	left, right expr
+	pos         int
+}
+
+func (e *binaryExpr) check(schema Schema) (Type, error) {
+	left, err := e.left.check(schema)
+	if err != nil {
+		return 0, err
+	}
+	right, err := e.right.check(schema)
+	if err != nil {
+		return 0, err
+	}
+
+	switch e.operator {
+	case "&&", "||":
+		if left != TypeBool || right != TypeBool {
+			return 0, e.mismatch(left, right)
+		}
+	case "==", "!=":
+		if left != right || left == TypeList {
+			return 0, e.mismatch(left, right)
+		}
+	case "<", "<=", ">", ">=":
+		if left != TypeNumber || right != TypeNumber {
+			return 0, e.mismatch(left, right)
+		}
+	case "in":
+		if left != TypeString || right != TypeList {
+			return 0, e.mismatch(left, right)
+		}
+	}
+	return TypeBool, nil
+}
+
+func (e *binaryExpr) mismatch(left, right Type) error {
+	return fmt.Errorf("%s can not be used between a %s and a %s at position %d", e.operator, left, right, e.pos)
+}
+
+func (e *binaryExpr) eval(ctx Context) (interface{}, error) {
+	left, err := e.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || skip the right side once the left side decides the result
+	switch e.operator {
+	case "&&":
+		if !left.(bool) {
+			return false, nil
+		}
+	case "||":
+		if left.(bool) {
+			return true, nil
+		}
+	}
+
+	right, err := e.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.operator {
+	case "&&", "||":
+		return right.(bool), nil
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	case "<":
+		return left.(float64) < right.(float64), nil
+	case "<=":
+		return left.(float64) <= right.(float64), nil
+	case ">":
+		return left.(float64) > right.(float64), nil
+	case ">=":
+		return left.(float64) >= right.(float64), nil
+	case "in":
+		for _, item := range right.([]string) {
+			if item == left.(string) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", e.operator)
+}
@@ -0,0 +1,147 @@
+package rules
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var testSchema = Schema{
+	"n":       TypeNumber,
+	"s":       TypeString,
+	"b":       TypeBool,
+	"l":       TypeList,
+	"missing": TypeNumber,
+}
+
+var testContext = Context{
+	"n": 10.0,
+	"s": "abc",
+	"b": true,
+	"l": []string{"x", "y"},
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		rule string
+		want bool
+	}{
+		{`n > 5`, true},
+		{`n < 5`, false},
+		{`n >= 10 && n <= 10`, true},
+		{`n == 10.5`, false},
+		{`n != 10`, false},
+		{`s == "abc"`, true},
+		{`s != 'abc'`, false},
+		{`"a\"b" == 'a"b'`, true},
+		{`b == true`, true},
+		{`"x" in l`, true},
+		{`"z" in l`, false},
+		{`s in l`, false},
+		{`!b`, false},
+		{`!!b`, true},
+		{`!(n == 10)`, false},
+		{`!b || n == 10`, true},
+		// && binds tighter than ||
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`false && true || true`, true},
+		{`false && (true || true)`, false},
+		// && and || skip the right side once the left side decides the result
+		{`false && missing > 1`, false},
+		{`true || missing > 1`, true},
+	}
+	for _, test := range tests {
+		rule, err := Compile(test.rule, testSchema)
+		if err != nil {
+			t.Errorf("Compile(%q) failed: %v", test.rule, err)
+			continue
+		}
+		got, err := rule.Evaluate(testContext)
+		if err != nil {
+			t.Errorf("Evaluate(%q) failed: %v", test.rule, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Evaluate(%q) = %v, want %v", test.rule, got, test.want)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	rule, err := Compile(`true && missing > 1`, testSchema)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	if _, err := rule.Evaluate(testContext); !errors.Is(err, ErrMissingVariable) {
+		t.Errorf("Evaluate with a missing variable = %v, want ErrMissingVariable", err)
+	}
+
+	rule, err = Compile(`n > 1`, testSchema)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+	_, err = rule.Evaluate(Context{"n": "10"})
+	if err == nil || errors.Is(err, ErrMissingVariable) {
+		t.Errorf("Evaluate with a wrong type = %v, want a type error", err)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{``, "unexpected end of rule"},
+		{`n >`, "unexpected end of rule"},
+		{`n > 1 &&`, "unexpected end of rule"},
+		{`1 < n < 5`, "can not be chained"},
+		{`n == 1 == true`, "can not be chained"},
+		{`unknown > 1`, "unknown variable unknown"},
+		{`n`, "rule must be true or false"},
+		{`n == "a"`, "== can not be used between a number and a string"},
+		{`s > 1`, "> can not be used between a string and a number"},
+		{`n in l`, "in can not be used between a number and a list"},
+		{`"x" in s`, "in can not be used between a string and a string"},
+		{`l == l`, "== can not be used between a list and a list"},
+		{`n && b`, "&& can not be used between a number and a bool"},
+		{`!n`, "! needs a bool"},
+		{`in l`, `unexpected "in"`},
+		{`s == "abc`, "unterminated string"},
+		{`s == "abc\`, "unterminated string"},
+		{`n > 1 @ 2`, "unexpected character '@'"},
+		{`n > 1 && é`, "unexpected character 'é'"},
+		{`1.2.3 > n`, "invalid number"},
+		{`(n > 1`, `expected ")"`},
+		{`n > 1)`, `unexpected ")"`},
+		{`n > 1 b`, `unexpected "b"`},
+	}
+	for _, test := range tests {
+		_, err := Compile(test.rule, testSchema)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("Compile(%q) = %v, want an error containing %q", test.rule, err, test.want)
+		}
+	}
+}
+
+func TestCompileLimits(t *testing.T) {
+	nested := strings.Repeat("(", maxDepth) + "b" + strings.Repeat(")", maxDepth)
+	if _, err := Compile(nested, testSchema); err != nil {
+		t.Errorf("Compile with %d parentheses failed: %v", maxDepth, err)
+	}
+
+	tooDeep := []string{
+		strings.Repeat("(", maxDepth+1) + "b" + strings.Repeat(")", maxDepth+1),
+		strings.Repeat("!", maxDepth+1) + "b",
+	}
+	for _, rule := range tooDeep {
+		if _, err := Compile(rule, testSchema); err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+			t.Errorf("Compile of a rule nested %d levels = %v, want a nesting error", maxDepth+1, err)
+		}
+	}
+
+	tooLong := "b" + strings.Repeat(" ", MaxLength)
+	if _, err := Compile(tooLong, testSchema); err == nil || !strings.Contains(err.Error(), "longer than") {
+		t.Errorf("Compile of a rule of %d characters = %v, want a length error", len(tooLong), err)
+	}
+}
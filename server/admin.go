@@ -8,4 +8,21 @@ import (
 
 func AdminRoutes(admin chi.Router) {
 	admin.Post("/coupons", handler.CreateCoupon)
+	admin.Get("/coupons", handler.ListCoupons)
+	admin.Post("/coupons/import", handler.ImportCoupons)
+	admin.Get("/coupons/export", handler.ExportCoupons)
+	admin.Get("/coupons/{id}", handler.GetCoupon)
+	admin.Put("/coupons/{id}", handler.ReplaceCoupon)
+	admin.Patch("/coupons/{id}", handler.UpdateCoupon)
+	admin.Delete("/coupons/{id}", handler.DeleteCoupon)
+	admin.Post("/coupons/{id}/status", handler.ChangeCouponStatus)
+	admin.Get("/coupons/{id}/status-history", handler.GetCouponStatusHistory)
+	admin.Post("/coupons/usages/reverse", handler.ReverseCouponUsage)
+	admin.Post("/coupons/{id}/users/{list}", handler.UploadCouponUsers)
+	admin.Get("/coupons/{id}/users/{list}", handler.ExportCouponUsers)
+	admin.Delete("/coupons/{id}/users/{list}", handler.ClearCouponUsers)
+	admin.Post("/campaigns", handler.CreateCampaign)
+	admin.Get("/campaigns/{id}/codes", handler.ExportCampaignCodes)
+	admin.Get("/users/{id}/context", handler.GetUserContext)
+	admin.Put("/users/{id}/context", handler.SaveUserContext)
 }
@@ -10,4 +10,8 @@ func PublicRoutes(public chi.Router) {
 	// Public coupon routes
 	public.Post("/coupons/applicable", handler.GetApplicableCoupons)
 	public.Post("/coupons/validate", handler.ValidateCoupon)
+	public.Post("/coupons/validate/combined", handler.ValidateCoupons)
+	public.Post("/coupons/reserve", handler.ReserveCoupon)
+	public.Post("/coupons/commit", handler.CommitCoupon)
+	public.Post("/coupons/release", handler.ReleaseCoupon)
 }
@@ -0,0 +1,47 @@
+package usercontext
+
+import (
+	"context"
+	"farmako-coupon-service/models"
+	"sync"
+)
+
+// FakeProvider keeps the user contexts in memory, it is meant for tests and local development
+type FakeProvider struct {
+	mu    sync.RWMutex
+	users map[string]models.UserContext
+	// Err is returned by UserContext when set, to simulate a failing provider
+	Err error
+}
+
+// NewFakeProvider returns a provider knowing the given users
+func NewFakeProvider(users ...models.UserContext) *FakeProvider {
+	p := &FakeProvider{users: make(map[string]models.UserContext, len(users))}
+	for _, user := range users {
+		p.Set(user)
+	}
+	return p
+}
+
+// Set adds or replaces the context of the user
+func (p *FakeProvider) Set(user models.UserContext) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.users[user.UserID] = user
+}
+
+// UserContext returns a copy of the context of the user, nil if the user is not known
+func (p *FakeProvider) UserContext(_ context.Context, userID string) (*models.UserContext, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.Err != nil {
+		return nil, p.Err
+	}
+	user, found := p.users[userID]
+	if !found {
+		return nil, nil
+	}
+	user.Segments = append([]string(nil), user.Segments...)
+	return &user, nil
+}
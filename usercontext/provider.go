@@ -0,0 +1,38 @@
+// Package usercontext supplies what the coupon rules know about a user, like their order count, signup date
+// and segments. The handlers resolve the context of the user once per request through the default provider.
+package usercontext
+
+import (
+	"context"
+	"farmako-coupon-service/models"
+	"sync"
+)
+
+// UserContextProvider supplies the context of a user, a nil context without an error means the user is not known
+type UserContextProvider interface {
+	UserContext(ctx context.Context, userID string) (*models.UserContext, error)
+}
+
+var (
+	mu              sync.RWMutex
+	defaultProvider UserContextProvider
+)
+
+// SetDefault sets the provider used by Resolve
+func SetDefault(provider UserContextProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultProvider = provider
+}
+
+// Resolve returns the context of the user from the default provider, nil if there is no user or no provider
+func Resolve(ctx context.Context, userID string) (*models.UserContext, error) {
+	mu.RLock()
+	provider := defaultProvider
+	mu.RUnlock()
+
+	if userID == "" || provider == nil {
+		return nil, nil
+	}
+	return provider.UserContext(ctx, userID)
+}
@@ -0,0 +1,34 @@
+package usercontext
+
+import (
+	"context"
+	"database/sql"
+	"farmako-coupon-service/dbhelper"
+	"farmako-coupon-service/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// TableProvider reads the user context from the user_profiles and user_segments tables which are kept up to date
+// by the user and order services through the admin user context endpoint
+type TableProvider struct {
+	db sqlx.Queryer
+}
+
+// NewTableProvider returns a provider reading the user context from the database
+func NewTableProvider(db sqlx.Queryer) *TableProvider {
+	return &TableProvider{db: db}
+}
+
+// UserContext returns the stored context of the user, nil if the user has no profile
+func (p *TableProvider) UserContext(_ context.Context, userID string) (*models.UserContext, error) {
+	user, err := dbhelper.GetUserContext(p.db, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch the context of user %s", userID)
+	}
+	return user, nil
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// DefaultCodeAlphabet leaves out the characters which are easy to confuse like 0/O and 1/I
+const DefaultCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// GenerateCouponCode generates a random coupon code of the given length after the prefix using the alphabet
+func GenerateCouponCode(prefix, alphabet string, length int) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+
+	var code strings.Builder
+	code.Grow(len(prefix) + length)
+	code.WriteString(prefix)
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(alphabet[n.Int64()])
+	}
+	return NormalizeCouponCode(code.String()), nil
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"io"
 	"math/big"
 	"net/http"
@@ -83,6 +84,10 @@ type RequestErr struct {
 
 	// IsClientError will be false if some internal server error occurred
 	IsClientError bool `json:"isClientError"`
+
+	// Fields will contain the validation error message for each invalid field
+	// Example: {"discount_value": "must be greater than 0"}
+	Fields map[string]string `json:"fields,omitempty"`
 } // @name RequestErr
 
 func init() {
@@ -141,6 +146,11 @@ func newClientError(err error, statusCode int, messageToUser string, additionalI
 	if statusCode == http.StatusInternalServerError {
 		clientErr = false
 	}
+	var fields map[string]string
+	var fieldErr FieldError
+	if errors.As(err, &fieldErr) {
+		fields = fieldErr.Fields()
+	}
 	return &RequestErr{
 		ID:            errorID,
 		MessageToUser: messageToUser,
@@ -148,6 +158,7 @@ func newClientError(err error, statusCode int, messageToUser string, additionalI
 		Err:           errString,
 		StatusCode:    statusCode,
 		IsClientError: clientErr,
+		Fields:        fields,
 	}
 }
 
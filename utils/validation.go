@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"farmako-coupon-service/rules"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+)
+
+var validate = newValidator()
+
+var (
+	couponCodeRegex     *regexp.Regexp
+	couponCodeRegexOnce sync.Once
+)
+
+// newValidator creates the validator reporting the fields by their json names
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	if err := v.RegisterValidation("coupon_code", func(fl validator.FieldLevel) bool {
+		return IsValidCouponCode(fl.Field().String())
+	}); err != nil {
+		logrus.Panicf("failed to register coupon code validation: %+v", err)
+	}
+	if err := v.RegisterValidation("eligibility_rule", func(fl validator.FieldLevel) bool {
+		_, err := rules.CompileEligibility(fl.Field().String())
+		return err == nil
+	}); err != nil {
+		logrus.Panicf("failed to register eligibility rule validation: %+v", err)
+	}
+	return v
+}
+
+// NormalizeCouponCode trims the whitespace around the coupon code and converts it to uppercase
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// IsValidCouponCode checks the whole coupon code against the COUPON_CODE_PATTERN environment variable,
+// RegularExpression is used if the pattern is not set or is invalid
+func IsValidCouponCode(code string) bool {
+	couponCodeRegexOnce.Do(func() {
+		pattern := os.Getenv("COUPON_CODE_PATTERN")
+		if pattern == "" {
+			pattern = RegularExpression
+		}
+		regex, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			logrus.Errorf("invalid COUPON_CODE_PATTERN %q, using the default pattern: %+v", pattern, err)
+			regex = regexp.MustCompile("^(?:" + RegularExpression + ")$")
+		}
+		couponCodeRegex = regex
+	})
+	return couponCodeRegex.MatchString(code)
+}
+
+// RegisterStructValidation registers the cross field validation for the given types
+func RegisterStructValidation(fn validator.StructLevelFunc, types ...interface{}) {
+	validate.RegisterStructValidation(fn, types...)
+}
+
+// ValidateStruct validates the struct as per its validate tags, the failed fields are returned as FieldError
+func ValidateStruct(s interface{}) error {
+	err := validate.Struct(s)
+	if validationErrors, ok := err.(validator.ValidationErrors); ok {
+		return FieldError{Err: validationErrors}
+	}
+	return err
+}
+
+func (f FieldError) Error() string {
+	messages := make([]string, 0, len(f.Err))
+	for _, fieldErr := range f.Err {
+		messages = append(messages, fmt.Sprintf("%s %s", fieldErr.Field(), fieldErrorMessage(fieldErr)))
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Fields returns the validation error message for each failed field keyed by the field name
+func (f FieldError) Fields() map[string]string {
+	fields := make(map[string]string, len(f.Err))
+	for _, fieldErr := range f.Err {
+		fields[fieldErr.Field()] = fieldErrorMessage(fieldErr)
+	}
+	return fields
+}
+
+// fieldErrorMessage returns a readable message for the failed validation tag
+func fieldErrorMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "oneof":
+		return fmt.Sprintf("must be one of [%s]", fieldErr.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fieldErr.Param())
+	case "gte":
+		return fmt.Sprintf("must be greater than or equal to %s", fieldErr.Param())
+	case "lt":
+		return fmt.Sprintf("must be less than %s", fieldErr.Param())
+	case "lte":
+		return fmt.Sprintf("must be less than or equal to %s", fieldErr.Param())
+	case "ltfield":
+		return fmt.Sprintf("must be before %s", fieldErr.Param())
+	case "ltefield":
+		return fmt.Sprintf("must not be after %s", fieldErr.Param())
+	case "coupon_code":
+		return "must match the coupon code format"
+	case "eligibility_rule":
+		// the rule is compiled again to report why it is invalid
+		if _, err := rules.CompileEligibility(fmt.Sprint(fieldErr.Value())); err != nil {
+			return fmt.Sprintf("is not a valid rule: %s", err)
+		}
+		return "is not a valid rule"
+	case "unique":
+		return fmt.Sprintf("must not repeat %s", fieldErr.Param())
+	default:
+		return fmt.Sprintf("failed on the %s validation", fieldErr.Tag())
+	}
+}
@@ -0,0 +1,32 @@
+package worker
+
+import (
+	"farmako-coupon-service/database"
+	"farmako-coupon-service/dbhelper"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StartReservationSweeper releases the coupon reservations whose TTL has expired every interval
+// till the done channel is closed
+func StartReservationSweeper(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			released, err := dbhelper.ReleaseExpiredReservations(database.FCS, now)
+			if err != nil {
+				logrus.WithError(err).Error("failed to release expired coupon reservations")
+				continue
+			}
+			if released > 0 {
+				logrus.Infof("released %d expired coupon reservations", released)
+			}
+		}
+	}
+}